@@ -0,0 +1,295 @@
+package admin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/request"
+	"github.com/francoishill/gomponents/user"
+)
+
+//BulkFormat is the file format of user imports and exports
+type BulkFormat string
+
+const (
+	FormatCSV        BulkFormat = "csv"
+	FormatJSONLines  BulkFormat = "jsonl"
+	MaxImportRows               = 10000
+	maxJSONLineBytes            = 1024 * 1024
+)
+
+//ImportRow is the outcome of a single row, rows are counted from 1 without the CSV header
+type ImportRow struct {
+	Row     int    `json:"row"`
+	UserID  string `json:"user_id,omitempty"`
+	Invited bool   `json:"invited,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+//ImportResult has the outcome of every row, nothing is added in a dry run. Error is set when the import stopped
+//before the end of the file, the rows before it are still added.
+type ImportResult struct {
+	DryRun bool        `json:"dry_run"`
+	Total  int         `json:"total"`
+	Added  int         `json:"added"`
+	Failed int         `json:"failed"`
+	Rows   []ImportRow `json:"rows"`
+	Error  string      `json:"error,omitempty"`
+}
+
+func (res *ImportResult) add(row ImportRow) {
+	res.Total++
+	if row.Error != "" {
+		res.Failed++
+	} else if !res.DryRun {
+		res.Added++
+	}
+	res.Rows = append(res.Rows, row)
+}
+
+//bulkFormat reads the format query param, it falls back to the Content-Type (for imports) and then to JSON lines
+func bulkFormat(r *http.Request) (BulkFormat, error) {
+	switch format := BulkFormat(r.URL.Query().Get("format")); format {
+	case FormatCSV, FormatJSONLines:
+		return format, nil
+	case "":
+		if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+			return FormatCSV, nil
+		}
+		return FormatJSONLines, nil
+	}
+	return "", errors.Errorf("Query param 'format' must be '%s' or '%s'", FormatCSV, FormatJSONLines)
+}
+
+func (f BulkFormat) contentType() string {
+	if f == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+//readImportRows calls fn for every row while reading body. A row that cannot be decoded or is invalid is passed to fn
+//with its error and reading continues, an error is only returned when body itself cannot be read.
+func readImportRows(body io.Reader, format BulkFormat, requestFactory RequestFactory, fn func(row int, req AddUserRequest, err error)) error {
+	tooManyRows := clienterror.NewError(errors.Errorf("Imports are limited to %d rows", MaxImportRows), http.StatusRequestEntityTooLarge)
+
+	if format == FormatJSONLines {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), maxJSONLineBytes)
+		row := 0
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if row++; row > MaxImportRows {
+				return tooManyRows
+			}
+			req := requestFactory.AddUser()
+			fn(row, req, request.DecodeAndValidateJSON(bytes.NewReader(line), req))
+		}
+		if err := scanner.Err(); err != nil {
+			return errors.Wrapf(err, "Failed to read import")
+		}
+		return nil
+	}
+
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return clienterror.NewError(errors.Wrapf(err, "Failed to read CSV header"), http.StatusBadRequest)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") //byte order mark of Excel exports
+	}
+
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if row > MaxImportRows {
+			return tooManyRows
+		}
+		if err != nil {
+			if _, isParseErr := err.(*csv.ParseError); !isParseErr {
+				return errors.Wrapf(err, "Failed to read import")
+			}
+			fn(row, nil, err)
+			continue
+		}
+		if len(fields) != len(header) {
+			fn(row, nil, errors.Errorf("Expected %d fields but found %d", len(header), len(fields)))
+			continue
+		}
+
+		record := map[string]string{}
+		for i, column := range header {
+			record[strings.TrimSpace(column)] = fields[i]
+		}
+		req, err := requestFactory.AddUserFromRecord(record)
+		if err == nil {
+			err = req.Validate()
+		}
+		fn(row, req, err)
+	}
+}
+
+//exportUsers writes first and the pages after it (as returned by Repo.ListPage), every user is shaped by shape. CSV
+//columns are the JSON fields of the shaped type (see csvColumns), nested values are written as JSON.
+func exportUsers(w io.Writer, format BulkFormat, userRepo user.Repo, q user.Query, first user.Page, shape func(u user.User) interface{}) error {
+	var csvWriter *csv.Writer
+	var columns []string
+	if format == FormatCSV {
+		csvWriter = csv.NewWriter(w)
+	}
+	jsonEncoder := json.NewEncoder(w)
+
+	page := first
+	for {
+		for _, u := range page.Users {
+			shaped := shape(u)
+			if format == FormatJSONLines {
+				if err := jsonEncoder.Encode(shaped); err != nil {
+					return errors.Wrapf(err, "Failed to write user '%s'", u.ID())
+				}
+				continue
+			}
+
+			fields, err := csvFields(shaped)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to convert user '%s'", u.ID())
+			}
+			if columns == nil {
+				if columns, err = csvColumns(shaped); err != nil {
+					return err
+				}
+				if err := csvWriter.Write(columns); err != nil {
+					return errors.Wrapf(err, "Failed to write CSV header")
+				}
+			}
+			record := make([]string, len(columns))
+			for i, column := range columns {
+				record[i] = fields[column]
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return errors.Wrapf(err, "Failed to write user '%s'", u.ID())
+			}
+		}
+
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return errors.Wrapf(err, "Failed to write users")
+			}
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		//repos without cursors are paged by offset
+		switch {
+		case page.NextCursor != "":
+			q.Cursor, q.Offset = page.NextCursor, 0
+		case q.Cursor == "" && len(page.Users) > 0 && page.Offset+len(page.Users) < page.Total:
+			q.Offset = page.Offset + len(page.Users)
+		default:
+			return nil
+		}
+
+		var err error
+		if page, err = userRepo.ListPage(q); err != nil {
+			return errors.Wrapf(err, "Failed to list users")
+		}
+	}
+}
+
+//csvColumns are the JSON field names of the shaped user type in declaration order, so that every row has the same
+//columns even when fields are omitted (like with omitempty). The shaped user must be a struct.
+func csvColumns(shaped interface{}) ([]string, error) {
+	t := reflect.TypeOf(shaped)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.Errorf("CSV exports need a struct user response, got %v", t)
+	}
+	return structColumns(t), nil
+}
+
+func structColumns(t reflect.Type) []string {
+	columns := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		//embedded structs without a name are inlined by encoding/json
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			columns = append(columns, structColumns(fieldType)...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+//csvFields flattens a shaped user (through its JSON form) into CSV values
+func csvFields(shaped interface{}) (map[string]string, error) {
+	data, err := json.Marshal(shaped)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, errors.Wrapf(err, "The user response must be a JSON object")
+	}
+
+	fields := map[string]string{}
+	for key, value := range values {
+		switch v := value.(type) {
+		case nil:
+			fields[key] = ""
+		case string:
+			fields[key] = v
+		case float64:
+			fields[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			fields[key] = strconv.FormatBool(v)
+		default:
+			nested, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = string(nested)
+		}
+	}
+	return fields, nil
+}
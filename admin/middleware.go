@@ -5,8 +5,10 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/francoishill/gomponents/audit"
 	"github.com/francoishill/gomponents/auth"
 	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
 )
 
 type Middleware interface {
@@ -15,14 +17,21 @@ type Middleware interface {
 
 func DefaultMiddleware(rendering rendering.Service, authMiddleware auth.Middleware) *defaultMiddleware {
 	return &defaultMiddleware{
-		rendering,
-		authMiddleware,
+		rendering:      rendering,
+		authMiddleware: authMiddleware,
 	}
 }
 
 type defaultMiddleware struct {
 	rendering      rendering.Service
 	authMiddleware auth.Middleware
+	auditor        audit.Service
+}
+
+//WithAudit records requests that were denied by RequireAdmin
+func (m *defaultMiddleware) WithAudit(auditor audit.Service) *defaultMiddleware {
+	m.auditor = auditor
+	return m
 }
 
 func (m *defaultMiddleware) RequireAdmin() func(http.Handler) http.Handler {
@@ -30,6 +39,13 @@ func (m *defaultMiddleware) RequireAdmin() func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user := m.authMiddleware.GetContextUser(r.Context())
 			if !user.IsAdmin() {
+				if m.auditor != nil {
+					event := audit.NewEvent(request.ClientContext(r), audit.ActionAccessDenied, audit.OutcomeDenied, user.ID(), "").
+						WithReason("Admin permission is required").
+						WithDetail("method", r.Method).
+						WithDetail("path", r.URL.Path)
+					m.auditor.Record(event)
+				}
 				m.rendering.RenderError(w, r, errors.Errorf("Admin permission is required for this action"), nil, http.StatusUnauthorized)
 				return
 			}
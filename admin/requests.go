@@ -1,12 +1,35 @@
 package admin
 
-import "github.com/francoishill/gomponents/auth"
+import (
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/user"
+)
 
 type RequestFactory interface {
 	AddUser() AddUserRequest
+	//AddUserFromRecord converts a CSV row of a user import (by column name) to an AddUserRequest, JSON lines rows are
+	//decoded into AddUser
+	AddUserFromRecord(record map[string]string) (AddUserRequest, error)
+	UpdateUser() UpdateUserRequest
+	ChangeStatus() ChangeStatusRequest
 }
 
 type AddUserRequest interface {
 	Validate() error
-	ToUser(passwordHash string) auth.User
+	//Password is the initial password, when it is empty the user is invited to choose one (see auth.Service.Invite)
+	Password() string
+	//ToUser creates the user with the status, which is user.StatusPendingVerification for invited users
+	ToUser(passwordHash string, status user.Status) auth.User
+}
+
+type UpdateUserRequest interface {
+	Validate() error
+	//ToUser returns the current user with the fields of the request applied, it must not change the ID, password
+	//hash or status (see ChangeStatusRequest)
+	ToUser(current user.User) user.User
+}
+
+type ChangeStatusRequest interface {
+	Validate() error
+	Status() user.Status
 }
@@ -1,9 +1,38 @@
 package admin
 
-import "github.com/francoishill/gomponents/user"
+import (
+	"time"
+
+	"github.com/francoishill/gomponents/audit"
+	"github.com/francoishill/gomponents/user"
+)
 
 type ResponseFactory interface {
 	User(user user.User) UserResponse
+	Users(page user.Page) UsersResponse
+	Imported(result ImportResult) ImportedResponse
+	TokensRevoked(userID string) TokensRevokedResponse
+	UserDeleted(userID string) UserDeletedResponse
+	StatusChanged(userID string, status user.Status) StatusChangedResponse
+	UserDisabled(userID string, disabled bool) UserDisabledResponse
+	PasswordResetSent(userID string) PasswordResetSentResponse
+	Unlocked(userID string) UnlockedResponse
+	InviteSent(userID string) InviteSentResponse
+	InviteRevoked(userID string) InviteRevokedResponse
+	Impersonating(userID string, accessToken string, expiresAt time.Time) ImpersonatingResponse
+	AuditEvents(page audit.Page) AuditEventsResponse
 }
 
 type UserResponse interface{}
+type UsersResponse interface{}
+type ImportedResponse interface{}
+type TokensRevokedResponse interface{}
+type UserDeletedResponse interface{}
+type StatusChangedResponse interface{}
+type UserDisabledResponse interface{}
+type PasswordResetSentResponse interface{}
+type UnlockedResponse interface{}
+type InviteSentResponse interface{}
+type InviteRevokedResponse interface{}
+type ImpersonatingResponse interface{}
+type AuditEventsResponse interface{}
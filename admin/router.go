@@ -2,25 +2,32 @@ package admin
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
-
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
+	"github.com/francoishill/gomponents/audit"
 	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/clienterror"
 	"github.com/francoishill/gomponents/encryption"
 	"github.com/francoishill/gomponents/rendering"
 	"github.com/francoishill/gomponents/request"
 	"github.com/francoishill/gomponents/user"
 )
 
+//Router is the user administration API, auditService may be nil in which case nothing is recorded and there is no
+//audit events endpoint
 func Router(
-	authMiddleware auth.Middleware, adminMiddlware Middleware,
+	authService auth.Service, authMiddleware auth.Middleware, adminMiddlware Middleware,
 	requestFactory RequestFactory, responseFactory ResponseFactory,
 	rendering rendering.Service,
-	userRepoFactory user.RepoFactory,
-	encryption encryption.Service) *chi.Mux {
+	userRepoFactory user.RepoFactory, userValidation user.Validation,
+	encryption encryption.Service,
+	auditService audit.Service) *chi.Mux {
 
 	r := chi.NewRouter()
 
@@ -28,19 +35,168 @@ func Router(
 	r.Use(authMiddleware.LoadUser())
 	r.Use(adminMiddlware.RequireAdmin())
 
+	//newEvent is an admin action on the user with targetID
+	newEvent := func(r *http.Request, action audit.Action, targetID string, err error) audit.Event {
+		actorID := authMiddleware.GetContextUser(r.Context()).ID()
+		event := audit.NewEvent(request.ClientContext(r), action, audit.OutcomeSuccess, actorID, targetID)
+		if err != nil {
+			event.Outcome = audit.OutcomeFailure
+			event = event.WithReason(err.Error())
+		}
+		return event
+	}
+	recordEvent := func(event audit.Event) {
+		if auditService != nil {
+			auditService.Record(event)
+		}
+	}
+	record := func(r *http.Request, action audit.Action, targetID string, err error) {
+		recordEvent(newEvent(r, action, targetID, err))
+	}
+
+	//getUser renders an error and returns false if the user of the {id} URL param cannot be loaded
+	getUser := func(w http.ResponseWriter, r *http.Request) (user.User, bool) {
+		userID, ok := request.RequiredURLParam(w, r, "id", rendering)
+		if !ok {
+			return nil, false
+		}
+
+		userRepo := userRepoFactory.Repo()
+		u, err := userRepo.Get(userID)
+		if err != nil {
+			if userRepo.IsErrNotFound(err) {
+				rendering.RenderError(w, r, clienterror.NewError(errors.Errorf("User '%s' not found", userID), http.StatusNotFound), nil, http.StatusNotFound)
+				return nil, false
+			}
+			rendering.RenderError(w, r, errors.Wrapf(err, "Failed to get user"), nil, http.StatusInternalServerError)
+			return nil, false
+		}
+		return u, true
+	}
+
+	//notSelf rejects actions that would lock the admin out of their own account
+	notSelf := func(w http.ResponseWriter, r *http.Request, userID string, action string) bool {
+		if authMiddleware.GetContextUser(r.Context()).ID() == userID {
+			rendering.RenderError(w, r, clienterror.NewError(errors.Errorf("Cannot %s yourself", action), http.StatusBadRequest), nil, http.StatusBadRequest)
+			return false
+		}
+		return true
+	}
+
+	//addUser adds the user of body, or only validates it in a dry run. Users without a password are invited, the user
+	//is returned when it was added even if the invite failed. Errors have the status for the client.
+	addUser := func(r *http.Request, body AddUserRequest, dryRun bool) (auth.User, error) {
+		//invited users get a random password that nobody knows until they accept the invite and choose their own
+		password, isInvite := body.Password(), body.Password() == ""
+		passwordHash := ""
+		if !dryRun {
+			if isInvite {
+				randomPassword, err := encryption.NewRandomPassword()
+				if err != nil {
+					return nil, errors.Wrapf(err, "Failed to generate password")
+				}
+				password = randomPassword
+			}
+			var err error
+			if passwordHash, err = encryption.HashPassword(password); err != nil {
+				return nil, errors.Wrapf(err, "Failed to hash new password")
+			}
+		}
+
+		status := user.StatusActive
+		if isInvite {
+			status = user.StatusPendingVerification
+		}
+		newUser := body.ToUser(passwordHash, status)
+		if err := userValidation.User(newUser); err != nil {
+			return nil, badRequest(err)
+		}
+		if !isInvite {
+			if err := authService.ValidatePassword(password, newUser); err != nil {
+				return nil, badRequest(err)
+			}
+		}
+		userRepo := userRepoFactory.Repo()
+		if dryRun {
+			//the same check Add does with its duplicate error, only possible if the user has an email
+			emailUser, isEmailUser := newUser.(auth.EmailUser)
+			if !isEmailUser {
+				return newUser, nil
+			}
+			if _, err := userRepo.GetByEmail(emailUser.Email()); err == nil {
+				return nil, clienterror.NewError(errors.New("User already exists"), http.StatusConflict)
+			} else if !userRepo.IsErrNotFound(err) {
+				return nil, errors.Wrapf(err, "Failed to check for an existing user")
+			}
+			return newUser, nil
+		}
+
+		if err := userRepo.Add(newUser); err != nil {
+			record(r, audit.ActionUserCreate, newUser.ID(), err)
+			if userRepo.IsDupErr(err) {
+				return nil, clienterror.NewError(errors.New("User already exists"), http.StatusConflict)
+			}
+			return nil, errors.Wrapf(err, "Failed to add user")
+		}
+		record(r, audit.ActionUserCreate, newUser.ID(), nil)
+
+		if isInvite {
+			err := authService.Invite(newUser)
+			record(r, audit.ActionInvite, newUser.ID(), err)
+			if err != nil {
+				//the user exists now, the invite can be resent with POST /{id}/invite
+				return newUser, errors.Wrapf(err, "User was added but the invite failed")
+			}
+		}
+		return newUser, nil
+	}
+
+	//changeStatus renders an error and returns false if the transition is not allowed or fails
+	changeStatus := func(w http.ResponseWriter, r *http.Request, userID string, action audit.Action, status user.Status) bool {
+		previous, err := authService.ChangeStatus(userID, status)
+		recordEvent(newEvent(r, action, userID, err).
+			WithDetail("from", string(previous)).
+			WithDetail("to", string(status)))
+		if err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return false
+		}
+		return true
+	}
+
+	if auditService != nil {
+		r.Get("/audit-events", func(w http.ResponseWriter, r *http.Request) {
+			q, err := audit.ParseQuery(r.URL.Query())
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+
+			page, err := auditService.Query(q)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.AuditEvents(page))
+		})
+	}
+
 	r.Route("/users", func(r chi.Router) {
 		//list
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-			users, err := userRepoFactory.Repo().List()
+			q, err := user.ParseQuery(r.URL.Query())
 			if err != nil {
-				rendering.RenderError(w, r, errors.Wrapf(err, "Failed to list users"), nil, http.StatusInternalServerError)
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
 				return
 			}
-			responses := []UserResponse{}
-			for _, u := range users {
-				responses = append(responses, responseFactory.User(u))
+
+			page, err := userRepoFactory.Repo().ListPage(q)
+			if err != nil {
+				//not wrapped, the repo returns a client error for unsupported filters and sorts
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
 			}
-			render.Respond(w, r, responses)
+			render.Respond(w, r, responseFactory.Users(page))
 		})
 
 		//add
@@ -51,25 +207,330 @@ func Router(
 				return
 			}
 
-			randomPassword, err := encryption.NewRandomPassword()
+			newUser, err := addUser(r, body, false)
 			if err != nil {
-				rendering.RenderError(w, r, errors.Wrapf(err, "Failed to generate password"), nil, http.StatusInternalServerError)
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
 				return
 			}
-			passwordHash, err := encryption.HashPassword(randomPassword)
+			render.Respond(w, r, responseFactory.User(newUser))
+		})
+
+		r.Post("/{id}/revoke-tokens", func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := request.RequiredURLParam(w, r, "id", rendering)
+			if !ok {
+				return
+			}
+
+			err := authService.RevokeAllTokens(userID)
+			record(r, audit.ActionRevokeTokens, userID, err)
 			if err != nil {
-				rendering.RenderError(w, r, errors.Wrapf(err, "Failed to hash new password"), nil, http.StatusInternalServerError)
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
 				return
 			}
+			render.Respond(w, r, responseFactory.TokensRevoked(userID))
+		})
 
-			newUser := body.ToUser(passwordHash)
-			if err := userRepoFactory.Repo().Add(newUser); err != nil {
-				rendering.RenderError(w, r, errors.Wrapf(err, "Failed to add user"), nil, http.StatusInternalServerError)
+		r.Post("/{id}/unlock", func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := request.RequiredURLParam(w, r, "id", rendering)
+			if !ok {
 				return
 			}
-			render.Respond(w, r, responseFactory.User(newUser))
+
+			err := authService.UnlockUser(userID)
+			record(r, audit.ActionUnlock, userID, err)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.Unlocked(userID))
+		})
+
+		//import users from CSV or JSON lines (see the format query param), every row is handled like the add endpoint.
+		//With dry_run=true the rows are only validated, including duplicate emails within the file and of existing users.
+		r.Post("/import", func(w http.ResponseWriter, r *http.Request) {
+			format, err := bulkFormat(r)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+			result := ImportResult{Rows: []ImportRow{}}
+			if dryRun := r.URL.Query().Get("dry_run"); dryRun != "" {
+				if result.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+					rendering.RenderError(w, r, errors.New("Query param 'dry_run' must be a boolean"), nil, http.StatusBadRequest)
+					return
+				}
+			}
+
+			//a dry run adds nothing, so duplicates within the file are not caught by the repo
+			rowsByEmail := map[string]int{}
+			err = readImportRows(r.Body, format, requestFactory, func(row int, body AddUserRequest, err error) {
+				importRow := ImportRow{Row: row}
+				var newUser auth.User
+				if err == nil {
+					newUser, err = addUser(r, body, result.DryRun)
+				}
+				if emailUser, isEmailUser := newUser.(auth.EmailUser); err == nil && result.DryRun && isEmailUser {
+					email := strings.ToLower(strings.TrimSpace(emailUser.Email()))
+					if firstRow, isDup := rowsByEmail[email]; isDup {
+						err = clienterror.NewError(errors.Errorf("Email is the same as in row %d", firstRow), http.StatusConflict)
+					} else {
+						rowsByEmail[email] = row
+					}
+				}
+				if newUser != nil && !result.DryRun {
+					importRow.UserID = newUser.ID()
+					importRow.Invited = body.Password() == "" && err == nil
+				}
+				if err != nil {
+					importRow.Error = err.Error()
+				}
+				result.add(importRow)
+			})
+			if err != nil {
+				logrus.WithError(err).WithField("rows", result.Total).Error("User import stopped early")
+				result.Error = err.Error()
+			}
+			render.Respond(w, r, responseFactory.Imported(result))
+		})
+
+		//export the users matching the filters, search and sort of the list endpoint as CSV or JSON lines
+		r.Get("/export", func(w http.ResponseWriter, r *http.Request) {
+			format, err := bulkFormat(r)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+			q, err := user.ParseQuery(r.URL.Query())
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+			q.Cursor, q.Offset, q.Limit = "", 0, user.MaxQueryLimit
+
+			//the first page is loaded before writing, so that a bad query still gets an error status
+			userRepo := userRepoFactory.Repo()
+			first, err := userRepo.ListPage(q)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			record(r, audit.ActionUserExport, "", nil)
+
+			w.Header().Set("Content-Type", format.contentType())
+			w.Header().Set("Content-Disposition", `attachment; filename="users.`+string(format)+`"`)
+			w.WriteHeader(http.StatusOK)
+			shape := func(u user.User) interface{} { return responseFactory.User(u) }
+			if err := exportUsers(w, format, userRepo, q, first, shape); err != nil {
+				//too late for an error status, the client gets a truncated file
+				logrus.WithError(err).Error("User export failed")
+			}
+		})
+
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			u, ok := getUser(w, r)
+			if !ok {
+				return
+			}
+			render.Respond(w, r, responseFactory.User(u))
+		})
+
+		r.Patch("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			body := requestFactory.UpdateUser()
+			if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+			current, ok := getUser(w, r)
+			if !ok {
+				return
+			}
+
+			updatedUser := body.ToUser(current)
+			if updatedUser.ID() != current.ID() {
+				rendering.RenderError(w, r, errors.New("The user ID cannot be changed"), nil, http.StatusBadRequest)
+				return
+			}
+			if updatedUser.Status() != current.Status() {
+				rendering.RenderError(w, r, errors.New("Use the status endpoint to change the account status"), nil, http.StatusBadRequest)
+				return
+			}
+			if current.IsAdmin() && !updatedUser.IsAdmin() && !notSelf(w, r, current.ID(), "remove admin permission from") {
+				return
+			}
+			if err := userValidation.User(updatedUser); err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+
+			//an email change goes through the auth service, which marks the new address as not verified and revokes the
+			//password reset and magic login tokens sent to the old one
+			currentEmailUser, isEmailUser := current.(auth.EmailUser)
+			updatedEmailUser, isUpdatedEmailUser := updatedUser.(auth.EmailUser)
+			if isEmailUser && isUpdatedEmailUser &&
+				!strings.EqualFold(strings.TrimSpace(updatedEmailUser.Email()), strings.TrimSpace(currentEmailUser.Email())) {
+				changedUser, _, err := authService.SetEmail(currentEmailUser, updatedEmailUser)
+				record(r, audit.ActionUserUpdate, current.ID(), err)
+				if err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+					return
+				}
+				render.Respond(w, r, responseFactory.User(changedUser))
+				return
+			}
+
+			userRepo := userRepoFactory.Repo()
+			if err := userRepo.Update(updatedUser); err != nil {
+				record(r, audit.ActionUserUpdate, current.ID(), err)
+				if userRepo.IsDupErr(err) {
+					rendering.RenderError(w, r, clienterror.NewError(errors.New("Email is already in use"), http.StatusConflict), nil, http.StatusConflict)
+					return
+				}
+				rendering.RenderError(w, r, errors.Wrapf(err, "Failed to update user"), nil, http.StatusInternalServerError)
+				return
+			}
+			record(r, audit.ActionUserUpdate, current.ID(), nil)
+			render.Respond(w, r, responseFactory.User(updatedUser))
+		})
+
+		//soft delete, the user is kept with user.StatusDeleted
+		r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			u, ok := getUser(w, r)
+			if !ok || !notSelf(w, r, u.ID(), "delete") {
+				return
+			}
+
+			if !changeStatus(w, r, u.ID(), audit.ActionUserDelete, user.StatusDeleted) {
+				return
+			}
+			render.Respond(w, r, responseFactory.UserDeleted(u.ID()))
+		})
+
+		//activate, suspend or lock, see user.Status for the allowed transitions
+		r.Post("/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+			body := requestFactory.ChangeStatus()
+			if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+			u, ok := getUser(w, r)
+			if !ok {
+				return
+			}
+			if body.Status() != user.StatusActive && !notSelf(w, r, u.ID(), "deactivate") {
+				return
+			}
+
+			if !changeStatus(w, r, u.ID(), audit.ActionUserStatus, body.Status()) {
+				return
+			}
+			render.Respond(w, r, responseFactory.StatusChanged(u.ID(), body.Status()))
+		})
+
+		//disable and enable suspend and reactivate the user, like the status endpoint
+		r.Post("/{id}/disable", func(w http.ResponseWriter, r *http.Request) {
+			u, ok := getUser(w, r)
+			if !ok || !notSelf(w, r, u.ID(), "disable") {
+				return
+			}
+
+			if !changeStatus(w, r, u.ID(), audit.ActionUserDisable, user.StatusSuspended) {
+				return
+			}
+			render.Respond(w, r, responseFactory.UserDisabled(u.ID(), true))
+		})
+
+		r.Post("/{id}/enable", func(w http.ResponseWriter, r *http.Request) {
+			u, ok := getUser(w, r)
+			if !ok {
+				return
+			}
+			//other statuses (like locked) are changed with the status endpoint
+			if !user.IsDisabled(u) {
+				rendering.RenderError(w, r, clienterror.NewError(errors.Errorf("User '%s' is not disabled", u.ID()), http.StatusConflict), nil, http.StatusConflict)
+				return
+			}
+
+			if !changeStatus(w, r, u.ID(), audit.ActionUserEnable, user.StatusActive) {
+				return
+			}
+			render.Respond(w, r, responseFactory.UserDisabled(u.ID(), false))
+		})
+
+		//sends a password reset token to the user, the current password keeps working until the token is used
+		r.Post("/{id}/reset-password", func(w http.ResponseWriter, r *http.Request) {
+			u, ok := getUser(w, r)
+			if !ok {
+				return
+			}
+			authUser, ok := u.(auth.User)
+			if !ok {
+				rendering.RenderError(w, r, errors.New("User does not implement auth.User"), nil, http.StatusInternalServerError)
+				return
+			}
+
+			err := authService.ForgotPassword(authUser)
+			record(r, audit.ActionSendPasswordReset, u.ID(), err)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.PasswordResetSent(u.ID()))
+		})
+
+		//resend
+		r.Post("/{id}/invite", func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := request.RequiredURLParam(w, r, "id", rendering)
+			if !ok {
+				return
+			}
+
+			err := authService.ResendInvite(userID)
+			record(r, audit.ActionInvite, userID, err)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.InviteSent(userID))
+		})
+
+		r.Delete("/{id}/invite", func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := request.RequiredURLParam(w, r, "id", rendering)
+			if !ok {
+				return
+			}
+
+			err := authService.RevokeInvite(userID)
+			record(r, audit.ActionInviteRevoke, userID, err)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.InviteRevoked(userID))
+		})
+
+		r.Post("/{id}/impersonate", func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := request.RequiredURLParam(w, r, "id", rendering)
+			if !ok {
+				return
+			}
+
+			actor := authMiddleware.GetContextUser(r.Context())
+			accessToken, expiresAt, err := authService.Impersonate(request.ClientContext(r), actor, userID)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.Impersonating(userID, accessToken, expiresAt))
 		})
 	})
 
 	return r
 }
+
+//badRequest keeps the status (and details) of client errors
+func badRequest(err error) error {
+	if _, isClientErr := err.(clienterror.Error); isClientErr {
+		return err
+	}
+	return clienterror.NewError(err, http.StatusBadRequest)
+}
@@ -1,16 +1,31 @@
 package anonymous
 
-import "github.com/francoishill/gomponents/auth"
+import (
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/user"
+)
 
 type RequestFactory interface {
 	Register() RegisterRequest
 	Login() LoginRequest
+	VerifyMFA() VerifyMFARequest
+	Refresh() RefreshRequest
+	RequestMagicLogin() RequestMagicLoginRequest
 	MagicLogin() MagicLoginRequest
+	ForgotPassword() ForgotPasswordRequest
+	ResetPassword() ResetPasswordRequest
+	AcceptInvite() AcceptInviteRequest
+	VerifyEmail() VerifyEmailRequest
+	ResendEmailVerification() ResendEmailVerificationRequest
 }
 
 type RegisterRequest interface {
 	Validate() error
-	LoadUser() (auth.User, error)
+	//Password is the plain password, it is checked against the password policy
+	Password() string
+	//LoadUser creates the new user with the status, which is user.StatusPendingVerification when email verification is
+	//required (see auth.Service.EmailVerificationRequired)
+	LoadUser(status user.Status) (auth.User, error)
 }
 
 type LoginRequest interface {
@@ -19,8 +34,52 @@ type LoginRequest interface {
 	LoadUser() (auth.User, error)
 }
 
+type VerifyMFARequest interface {
+	Validate() error
+	PendingToken() string
+	Code() string
+}
+
+type RefreshRequest interface {
+	Validate() error
+	RefreshToken() string
+}
+
+type RequestMagicLoginRequest interface {
+	Validate() error
+	LoadUser() (auth.User, error)
+}
+
 type MagicLoginRequest interface {
 	Validate() error
 	Token() string
 	LoadUser() (auth.User, error)
 }
+
+type ForgotPasswordRequest interface {
+	Validate() error
+	LoadUser() (auth.User, error)
+}
+
+type ResetPasswordRequest interface {
+	Validate() error
+	Token() string
+	NewPassword() string
+}
+
+type AcceptInviteRequest interface {
+	Validate() error
+	Token() string
+	//Password is the password chosen by the invitee, it is checked against the password policy
+	Password() string
+}
+
+type VerifyEmailRequest interface {
+	Validate() error
+	Token() string
+}
+
+type ResendEmailVerificationRequest interface {
+	Validate() error
+	LoadUser() (auth.User, error)
+}
@@ -1,9 +1,28 @@
 package anonymous
 
-import "github.com/francoishill/gomponents/auth"
+import (
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/token"
+)
 
 type ResponseFactory interface {
-	LoggedIn(user auth.User, token string) LoggedInResponse
+	LoggedIn(user auth.User, tokens token.Pair) LoggedInResponse
+	MFARequired(user auth.User, pendingToken string) MFARequiredResponse
+	LoggedOut() LoggedOutResponse
+	MagicLoginRequested() MagicLoginRequestedResponse
+	PasswordResetRequested() PasswordResetRequestedResponse
+	PasswordReset() PasswordResetResponse
+	VerificationPending(user auth.User) VerificationPendingResponse
+	EmailVerificationSent() EmailVerificationSentResponse
+	EmailVerified() EmailVerifiedResponse
 }
 
 type LoggedInResponse interface{}
+type MFARequiredResponse interface{}
+type LoggedOutResponse interface{}
+type MagicLoginRequestedResponse interface{}
+type PasswordResetRequestedResponse interface{}
+type PasswordResetResponse interface{}
+type VerificationPendingResponse interface{}
+type EmailVerificationSentResponse interface{}
+type EmailVerifiedResponse interface{}
@@ -5,14 +5,22 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
+	"github.com/sirupsen/logrus"
 
 	"github.com/francoishill/gomponents/auth"
 	"github.com/francoishill/gomponents/rendering"
 	"github.com/francoishill/gomponents/request"
+	"github.com/francoishill/gomponents/user"
 )
 
-func Router(rendering rendering.Service, auth auth.Service, requestFactory RequestFactory, responseFactory ResponseFactory) *chi.Mux {
+//Router takes optional middlewares (like ratelimit.Middleware) that are applied to all its endpoints
+func Router(
+	rendering rendering.Service, auth auth.Service, authMiddleware auth.Middleware,
+	requestFactory RequestFactory, responseFactory ResponseFactory,
+	middlewares ...func(http.Handler) http.Handler) *chi.Mux {
+
 	r := chi.NewRouter()
+	r.Use(middlewares...)
 
 	r.Post("/register", func(w http.ResponseWriter, r *http.Request) {
 		body := requestFactory.Register()
@@ -21,19 +29,28 @@ func Router(rendering rendering.Service, auth auth.Service, requestFactory Reque
 			return
 		}
 
-		user, err := body.LoadUser()
+		status := user.StatusActive
+		if auth.EmailVerificationRequired() {
+			status = user.StatusPendingVerification
+		}
+		user, err := body.LoadUser(status)
 		if err != nil {
 			rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
 			return
 		}
 
-		token, err := auth.Register(user)
+		tokens, err := auth.Register(request.ClientContext(r), user, body.Password())
 		if err != nil {
 			rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
 			return
 		}
 
-		render.Respond(w, r, responseFactory.LoggedIn(user, token))
+		if auth.EmailVerificationRequired() {
+			render.Respond(w, r, responseFactory.VerificationPending(user))
+			return
+		}
+
+		render.Respond(w, r, responseFactory.LoggedIn(user, tokens))
 	})
 
 	r.Post("/login", func(w http.ResponseWriter, r *http.Request) {
@@ -44,18 +61,86 @@ func Router(rendering rendering.Service, auth auth.Service, requestFactory Reque
 		}
 
 		user, err := body.LoadUser()
+		if err != nil {
+			rendering.RenderError(w, r, auth.LoginUnknownUser(request.ClientContext(r), err), nil, http.StatusUnauthorized)
+			return
+		}
+
+		tokens, err := auth.Login(request.ClientContext(r), user, body.Password())
+		if pendingToken, isMFARequired := auth.IsMFARequiredErr(err); isMFARequired {
+			render.Respond(w, r, responseFactory.MFARequired(user, pendingToken))
+			return
+		}
 		if err != nil {
 			rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
 			return
 		}
 
-		token, err := auth.Login(user, body.Password())
+		render.Respond(w, r, responseFactory.LoggedIn(user, tokens))
+	})
+
+	r.Post("/login/mfa", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.VerifyMFA()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		user, tokens, err := auth.VerifyMFA(request.ClientContext(r), body.PendingToken(), body.Code())
 		if err != nil {
 			rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
 			return
 		}
 
-		render.Respond(w, r, responseFactory.LoggedIn(user, token))
+		render.Respond(w, r, responseFactory.LoggedIn(user, tokens))
+	})
+
+	r.Post("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.Refresh()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		user, tokens, err := auth.Refresh(request.ClientContext(r), body.RefreshToken())
+		if err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.LoggedIn(user, tokens))
+	})
+
+	r.With(authMiddleware.Authenticate()...).Post("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.Logout(r.Context()); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.LoggedOut())
+	})
+
+	r.Post("/magic-link", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.RequestMagicLogin()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		//respond the same whether or not the user exists, to not leak which accounts exist
+		user, err := body.LoadUser()
+		if err != nil {
+			logrus.WithError(err).Warn("Magic link requested for unknown user")
+			render.Respond(w, r, responseFactory.MagicLoginRequested())
+			return
+		}
+
+		if err := auth.RequestMagicLogin(user); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.MagicLoginRequested())
 	})
 
 	r.Post("/magic-login", func(w http.ResponseWriter, r *http.Request) {
@@ -66,18 +151,116 @@ func Router(rendering rendering.Service, auth auth.Service, requestFactory Reque
 		}
 
 		user, err := body.LoadUser()
+		if err != nil {
+			rendering.RenderError(w, r, auth.LoginUnknownUser(request.ClientContext(r), err), nil, http.StatusUnauthorized)
+			return
+		}
+
+		tokens, err := auth.MagicLogin(request.ClientContext(r), user, body.Token())
+		if pendingToken, isMFARequired := auth.IsMFARequiredErr(err); isMFARequired {
+			render.Respond(w, r, responseFactory.MFARequired(user, pendingToken))
+			return
+		}
 		if err != nil {
 			rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
 			return
 		}
 
-		token, err := auth.MagicLogin(user, body.Token())
+		render.Respond(w, r, responseFactory.LoggedIn(user, tokens))
+	})
+
+	r.Post("/forgot-password", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.ForgotPassword()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		//respond the same whether or not the user exists, to not leak which accounts exist
+		user, err := body.LoadUser()
+		if err != nil {
+			logrus.WithError(err).Warn("Forgot password requested for unknown user")
+			render.Respond(w, r, responseFactory.PasswordResetRequested())
+			return
+		}
+
+		if err := auth.ForgotPassword(user); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.PasswordResetRequested())
+	})
+
+	r.Post("/reset-password", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.ResetPassword()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		if err := auth.ResetPassword(body.Token(), body.NewPassword()); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.PasswordReset())
+	})
+
+	r.Post("/accept-invite", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.AcceptInvite()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		user, tokens, err := auth.AcceptInvite(request.ClientContext(r), body.Token(), body.Password())
 		if err != nil {
 			rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
 			return
 		}
 
-		render.Respond(w, r, responseFactory.LoggedIn(user, token))
+		render.Respond(w, r, responseFactory.LoggedIn(user, tokens))
+	})
+
+	r.Post("/verify-email", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.VerifyEmail()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		if err := auth.VerifyEmail(body.Token()); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.EmailVerified())
+	})
+
+	r.Post("/resend-email-verification", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.ResendEmailVerification()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		//respond the same whether or not the user exists (or is already verified), to not leak which accounts exist
+		user, err := body.LoadUser()
+		if err != nil {
+			logrus.WithError(err).Warn("Email verification resend requested for unknown user")
+			render.Respond(w, r, responseFactory.EmailVerificationSent())
+			return
+		}
+
+		if !user.IsEmailVerified() {
+			if err := auth.SendEmailVerification(user); err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		render.Respond(w, r, responseFactory.EmailVerificationSent())
 	})
 
 	return r
@@ -0,0 +1,17 @@
+package apikey
+
+import "time"
+
+type Repo interface {
+	IsErrNotFound(err error) bool
+
+	Add(key Key) error
+	Get(id string) (Key, error)
+	ListForUser(userID string) ([]Key, error)
+	Revoke(id string, revokedAt time.Time) error
+	SetLastUsed(id string, lastUsedAt time.Time) error
+}
+
+type RepoFactory interface {
+	Repo() Repo
+}
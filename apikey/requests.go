@@ -0,0 +1,14 @@
+package apikey
+
+import "time"
+
+type RequestFactory interface {
+	Create() CreateRequest
+}
+
+type CreateRequest interface {
+	Validate() error
+	Name() string
+	Scopes() []string
+	ExpiresAt() *time.Time
+}
@@ -0,0 +1,12 @@
+package apikey
+
+type ResponseFactory interface {
+	Key(key Key) KeyResponse
+	//Created is the only response that includes the plain key, it cannot be retrieved again
+	Created(key Key, plainKey string) CreatedResponse
+	Revoked(key Key) RevokedResponse
+}
+
+type KeyResponse interface{}
+type CreatedResponse interface{}
+type RevokedResponse interface{}
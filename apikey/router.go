@@ -0,0 +1,166 @@
+package apikey
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/admin"
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
+)
+
+//ScopeManageKeys is required for API key requests to manage API keys, so that a leaked key cannot mint new keys. Such
+//a key can also only create keys with scopes it holds itself.
+const ScopeManageKeys = "api-keys"
+
+//Router lets the authenticated user manage their own API keys
+func Router(
+	authMiddleware auth.Middleware,
+	rendering rendering.Service,
+	service Service,
+	requestFactory RequestFactory, responseFactory ResponseFactory) *chi.Mux {
+
+	r := chi.NewRouter()
+
+	r.Use(authMiddleware.Authenticate()...)
+	r.Use(authMiddleware.RequireScopes(ScopeManageKeys))
+	r.Use(authMiddleware.LoadUser())
+
+	h := handlers{authMiddleware, rendering, service, requestFactory, responseFactory}
+	currentUserID := func(r *http.Request) string {
+		return authMiddleware.GetContextUser(r.Context()).ID()
+	}
+
+	r.Get("/", h.list(currentUserID))
+	//a key would outlive the impersonation token
+	r.With(authMiddleware.RejectImpersonation()).Post("/", h.create(currentUserID))
+	r.Delete("/{id}", h.revoke(currentUserID))
+
+	return r
+}
+
+//AdminRouter lets admins manage the API keys of any user
+func AdminRouter(
+	authMiddleware auth.Middleware, adminMiddleware admin.Middleware,
+	rendering rendering.Service,
+	service Service,
+	requestFactory RequestFactory, responseFactory ResponseFactory) *chi.Mux {
+
+	r := chi.NewRouter()
+
+	r.Use(authMiddleware.Authenticate()...)
+	r.Use(authMiddleware.RequireScopes(ScopeManageKeys))
+	r.Use(authMiddleware.LoadUser())
+	r.Use(adminMiddleware.RequireAdmin())
+
+	h := handlers{authMiddleware, rendering, service, requestFactory, responseFactory}
+	urlUserID := func(r *http.Request) string {
+		return chi.URLParam(r, "userID")
+	}
+
+	r.Route("/users/{userID}", func(r chi.Router) {
+		r.Get("/", h.list(urlUserID))
+		r.With(authMiddleware.RejectImpersonation()).Post("/", h.create(urlUserID))
+		r.Delete("/{id}", h.revoke(urlUserID))
+	})
+
+	return r
+}
+
+//userIDFunc returns the user whose keys are managed
+type userIDFunc func(r *http.Request) string
+
+type handlers struct {
+	authMiddleware  auth.Middleware
+	rendering       rendering.Service
+	service         Service
+	requestFactory  RequestFactory
+	responseFactory ResponseFactory
+}
+
+func (h handlers) list(userIDFunc userIDFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := userIDFunc(r)
+		keys, err := h.service.List(userID)
+		if err != nil {
+			h.rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		responses := []KeyResponse{}
+		for _, k := range keys {
+			responses = append(responses, h.responseFactory.Key(k))
+		}
+		render.Respond(w, r, responses)
+	}
+}
+
+func (h handlers) create(userIDFunc userIDFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := h.requestFactory.Create()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			h.rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		//a key cannot grant more than it holds, tokens are not limited by scopes
+		if callerScopes, isAPIKey := h.authMiddleware.GetContextAPIKeyScopes(r.Context()); isAPIKey {
+			for _, scope := range body.Scopes() {
+				if !containsScope(callerScopes, scope) {
+					h.rendering.RenderError(w, r, clienterror.NewError(errors.Errorf("Cannot grant scope '%s' that the API key does not hold", scope), http.StatusForbidden), nil, http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		userID := userIDFunc(r)
+		key, plainKey, err := h.service.Create(userID, body.Name(), body.Scopes(), body.ExpiresAt())
+		if err != nil {
+			h.rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Status(r, http.StatusCreated)
+		render.Respond(w, r, h.responseFactory.Created(key, plainKey))
+	}
+}
+
+func (h handlers) revoke(userIDFunc userIDFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyID, ok := request.RequiredURLParam(w, r, "id", h.rendering)
+		if !ok {
+			return
+		}
+
+		key, err := h.service.Get(keyID)
+		if err != nil {
+			h.rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+		//also checked for admins so that a key id cannot be revoked through the wrong user's route
+		if userID := userIDFunc(r); key.UserID != userID {
+			h.rendering.RenderError(w, r, clienterror.NewError(errors.Errorf("API key '%s' not found", keyID), http.StatusNotFound), nil, http.StatusNotFound)
+			return
+		}
+
+		if err := h.service.Revoke(key.ID); err != nil {
+			h.rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+		render.Respond(w, r, h.responseFactory.Revoked(key))
+	}
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
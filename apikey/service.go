@@ -0,0 +1,176 @@
+package apikey
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/encryption"
+)
+
+//Service manages API keys and implements auth.APIKeyAuthenticator and auth.APIKeys. A plain key has the form
+//"<prefix>_<id>_<secret>", the prefix makes keys recognizable (like in secret scanners) and the id is used for lookup.
+type Service interface {
+	//Create fails if expiresAt is not in the future
+	Create(userID, name string, scopes []string, expiresAt *time.Time) (key Key, plainKey string, err error)
+	Get(id string) (Key, error)
+	List(userID string) ([]Key, error)
+	Revoke(id string) error
+	//RevokeAllForUser revokes the active keys of the user
+	RevokeAllForUser(userID string) error
+
+	AuthenticateRequest(r *http.Request) (userID string, scopes []string, hasAPIKey bool, err error)
+}
+
+const (
+	idByteLength     = 8
+	secretByteLength = 32
+	separator        = "_"
+
+	//HeaderName is checked for the key, otherwise "Authorization: ApiKey <key>" is used
+	HeaderName          = "X-API-Key"
+	authorizationScheme = "ApiKey "
+)
+
+func DefaultService(prefix string, repoFactory RepoFactory, encryption encryption.Service) *defaultService {
+	if prefix == "" || strings.Contains(prefix, separator) {
+		logrus.Panicf("API key prefix is required and may not contain '%s'", separator)
+	}
+	return &defaultService{
+		prefix,
+		repoFactory,
+		encryption,
+	}
+}
+
+type defaultService struct {
+	prefix      string
+	repoFactory RepoFactory
+	encryption  encryption.Service
+}
+
+func (s *defaultService) Create(userID, name string, scopes []string, expiresAt *time.Time) (Key, string, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return Key{}, "", clienterror.NewError(errors.New("API key expiry must be in the future"), http.StatusBadRequest)
+	}
+
+	id, err := s.encryption.NewSecureToken(idByteLength)
+	if err != nil {
+		return Key{}, "", errors.Wrapf(err, "Failed to generate API key id")
+	}
+	secret, err := s.encryption.NewSecureToken(secretByteLength)
+	if err != nil {
+		return Key{}, "", errors.Wrapf(err, "Failed to generate API key secret")
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	key := Key{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Hash:      s.encryption.HashToken(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repoFactory.Repo().Add(key); err != nil {
+		return Key{}, "", errors.Wrapf(err, "Failed to add API key")
+	}
+
+	logrus.WithField("user-id", userID).WithField("api-key-id", id).Info("Created API key")
+	return key, s.prefix + separator + id + separator + secret, nil
+}
+
+func (s *defaultService) Get(id string) (Key, error) {
+	repo := s.repoFactory.Repo()
+	key, err := repo.Get(id)
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return Key{}, clienterror.NewError(errors.Errorf("API key '%s' not found", id), http.StatusNotFound)
+		}
+		return Key{}, errors.Wrapf(err, "Failed to get API key")
+	}
+	return key, nil
+}
+
+func (s *defaultService) List(userID string) ([]Key, error) {
+	keys, err := s.repoFactory.Repo().ListForUser(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list API keys")
+	}
+	return keys, nil
+}
+
+func (s *defaultService) Revoke(id string) error {
+	if err := s.repoFactory.Repo().Revoke(id, time.Now()); err != nil {
+		return errors.Wrapf(err, "Failed to revoke API key")
+	}
+	logrus.WithField("api-key-id", id).Info("Revoked API key")
+	return nil
+}
+
+func (s *defaultService) RevokeAllForUser(userID string) error {
+	keys, err := s.List(userID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !key.IsActive() {
+			continue
+		}
+		if err := s.Revoke(key.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *defaultService) AuthenticateRequest(r *http.Request) (string, []string, bool, error) {
+	plainKey := strings.TrimSpace(r.Header.Get(HeaderName))
+	if plainKey == "" {
+		if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, authorizationScheme) {
+			plainKey = strings.TrimSpace(strings.TrimPrefix(authorization, authorizationScheme))
+		}
+	}
+	if plainKey == "" {
+		return "", nil, false, nil
+	}
+
+	key, err := s.authenticate(plainKey)
+	if err != nil {
+		return "", nil, true, err
+	}
+	return key.UserID, key.Scopes, true, nil
+}
+
+func (s *defaultService) authenticate(plainKey string) (Key, error) {
+	invalidErr := errors.New("API key is invalid, expired or revoked")
+
+	parts := strings.SplitN(plainKey, separator, 3)
+	if len(parts) != 3 || parts[0] != s.prefix || parts[1] == "" || parts[2] == "" {
+		return Key{}, invalidErr
+	}
+
+	repo := s.repoFactory.Repo()
+	key, err := repo.Get(parts[1])
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return Key{}, invalidErr
+		}
+		return Key{}, errors.Wrapf(err, "Failed to get API key")
+	}
+	if !s.encryption.VerifyTokenHash(parts[2], key.Hash) || !key.IsActive() {
+		return Key{}, invalidErr
+	}
+
+	if err := repo.SetLastUsed(key.ID, time.Now()); err != nil {
+		logrus.WithError(err).WithField("api-key-id", key.ID).Warn("Failed to update API key last used time")
+	}
+	return key, nil
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/francoishill/gomponents/request"
+)
+
+type Action string
+
+const (
+	ActionRegister       Action = "auth.register"
+	ActionLogin          Action = "auth.login"
+	ActionMagicLogin     Action = "auth.magic_login"
+	ActionExternalLogin  Action = "auth.external_login"
+	ActionMFA            Action = "auth.mfa"
+	ActionLogout         Action = "auth.logout"
+	ActionPasswordReset  Action = "auth.password_reset"
+	ActionPasswordChange Action = "auth.password_change"
+	ActionImpersonate    Action = "auth.impersonate"
+	ActionInviteAccept   Action = "auth.invite_accept"
+
+	//ActionImpersonatedRequest is a request made by an admin (the actor) with an impersonation token, read-only
+	//requests are not recorded
+	ActionImpersonatedRequest Action = "auth.impersonated_request"
+
+	ActionUserCreate        Action = "admin.user_create"
+	ActionUserUpdate        Action = "admin.user_update"
+	ActionUserDelete        Action = "admin.user_delete"
+	ActionUserStatus        Action = "admin.user_status"
+	ActionUserDisable       Action = "admin.user_disable"
+	ActionUserEnable        Action = "admin.user_enable"
+	ActionUserExport        Action = "admin.user_export"
+	ActionSendPasswordReset Action = "admin.password_reset"
+	ActionRevokeTokens      Action = "admin.revoke_tokens"
+	ActionUnlock            Action = "admin.unlock"
+	ActionInvite            Action = "admin.invite"
+	ActionInviteRevoke      Action = "admin.invite_revoke"
+
+	ActionProfileUpdate Action = "account.profile_update"
+	ActionEmailChange   Action = "account.email_change"
+	ActionAccountDelete Action = "account.delete"
+
+	//ActionAccessDenied is an authorization denial, like a non-admin calling an admin endpoint
+	ActionAccessDenied Action = "authz.denied"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	OutcomeDenied  Outcome = "denied"
+)
+
+//Event is a security-relevant action. ActorID is who performed the action (empty for anonymous requests) and
+//TargetID the user it was performed on, they are the same for users acting on their own account.
+type Event struct {
+	ID        string            `bson:"_id" json:"id"`
+	Time      time.Time         `bson:"time" json:"time"`
+	Action    Action            `bson:"action" json:"action"`
+	Outcome   Outcome           `bson:"outcome" json:"outcome"`
+	ActorID   string            `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	TargetID  string            `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	IP        string            `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string            `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	RequestID string            `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	Reason    string            `bson:"reason,omitempty" json:"reason,omitempty"`
+	Details   map[string]string `bson:"details,omitempty" json:"details,omitempty"`
+}
+
+//NewEvent fills the client info from ctx (see request.ClientContext)
+func NewEvent(ctx context.Context, action Action, outcome Outcome, actorID, targetID string) Event {
+	client := request.ClientInfoFromContext(ctx)
+	return Event{
+		Time:      time.Now(),
+		Action:    action,
+		Outcome:   outcome,
+		ActorID:   actorID,
+		TargetID:  targetID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		RequestID: client.RequestID,
+	}
+}
+
+//WithReason returns a copy of the event with the reason, usually why it failed
+func (e Event) WithReason(reason string) Event {
+	e.Reason = reason
+	return e
+}
+
+//WithDetail returns a copy of the event with the detail added
+func (e Event) WithDetail(key, value string) Event {
+	details := map[string]string{}
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details[key] = value
+	e.Details = details
+	return e
+}
@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultQueryLimit = 50
+	MaxQueryLimit     = 500
+)
+
+//Query filters events, empty fields match everything. Events are returned newest first.
+type Query struct {
+	Action   Action
+	Outcome  Outcome
+	ActorID  string
+	TargetID string
+	From     *time.Time
+	To       *time.Time
+
+	Offset int
+	Limit  int
+}
+
+//Page is one page of the events matching a query, Total is the count of all matching events
+type Page struct {
+	Events []Event
+	Total  int
+	Offset int
+	Limit  int
+}
+
+//ParseQuery reads the query from URL values: action, outcome, actor, target, from and to (RFC3339), offset and limit
+func ParseQuery(values url.Values) (Query, error) {
+	q := Query{
+		Action:   Action(values.Get("action")),
+		Outcome:  Outcome(values.Get("outcome")),
+		ActorID:  values.Get("actor"),
+		TargetID: values.Get("target"),
+		Limit:    DefaultQueryLimit,
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if value := values.Get(param.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return Query{}, errors.Errorf("Query param '%s' must be an RFC3339 time", param.name)
+			}
+			*param.dest = &t
+		}
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *int
+	}{{"offset", &q.Offset}, {"limit", &q.Limit}} {
+		if value := values.Get(param.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return Query{}, errors.Errorf("Query param '%s' must be a non-negative number", param.name)
+			}
+			*param.dest = n
+		}
+	}
+
+	return q.normalized(), nil
+}
+
+func (q Query) normalized() Query {
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	if q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	return q
+}
+
+//Matches is used by sinks that filter in memory
+func (q Query) Matches(e Event) bool {
+	if q.Action != "" && e.Action != q.Action {
+		return false
+	}
+	if q.Outcome != "" && e.Outcome != q.Outcome {
+		return false
+	}
+	if q.ActorID != "" && e.ActorID != q.ActorID {
+		return false
+	}
+	if q.TargetID != "" && e.TargetID != q.TargetID {
+		return false
+	}
+	if q.From != nil && e.Time.Before(*q.From) {
+		return false
+	}
+	if q.To != nil && !e.Time.Before(*q.To) {
+		return false
+	}
+	return true
+}
+
+//pageOf pages events that are already filtered and sorted newest first
+func pageOf(events []Event, q Query) Page {
+	page := Page{Events: []Event{}, Total: len(events), Offset: q.Offset, Limit: q.Limit}
+	if q.Offset >= len(events) {
+		return page
+	}
+	end := q.Offset + q.Limit
+	if end > len(events) {
+		end = len(events)
+	}
+	page.Events = append(page.Events, events[q.Offset:end]...)
+	return page
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+//Service records events to a Sink. Record never fails the caller, since a broken audit sink should not lock users
+//out, failures are logged instead.
+type Service interface {
+	Record(event Event)
+	Query(q Query) (Page, error)
+}
+
+func DefaultService(sink Sink) *defaultService {
+	return &defaultService{
+		sink,
+	}
+}
+
+type defaultService struct {
+	sink Sink
+}
+
+func (s *defaultService) Record(event Event) {
+	logger := logrus.
+		WithField("audit-action", event.Action).
+		WithField("audit-outcome", event.Outcome).
+		WithField("actor-id", event.ActorID).
+		WithField("target-id", event.TargetID)
+
+	if event.ID == "" {
+		id, err := newEventID()
+		if err != nil {
+			logger.WithError(err).Error("Failed to record audit event")
+			return
+		}
+		event.ID = id
+	}
+
+	if err := s.sink.Write(event); err != nil {
+		logger.WithError(err).Error("Failed to record audit event")
+		return
+	}
+	logger.Debug("Recorded audit event")
+}
+
+func (s *defaultService) Query(q Query) (Page, error) {
+	page, err := s.sink.Query(q.normalized())
+	if err != nil {
+		return Page{}, errors.Wrapf(err, "Failed to query audit events")
+	}
+	return page, nil
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrapf(err, "Unable to generate audit event id")
+	}
+	return hex.EncodeToString(b), nil
+}
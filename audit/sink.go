@@ -0,0 +1,191 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/francoishill/gomponents/mongo"
+)
+
+//Sink stores events, Query must return the events newest first
+type Sink interface {
+	Write(event Event) error
+	Query(q Query) (Page, error)
+}
+
+//MemorySink keeps at most maxEvents (the oldest are dropped), a zero maxEvents keeps everything. It is meant for tests
+//and single instance setups.
+func MemorySink(maxEvents int) *memorySink {
+	return &memorySink{maxEvents: maxEvents}
+}
+
+type memorySink struct {
+	lock      sync.RWMutex
+	maxEvents int
+	events    []Event
+}
+
+func (s *memorySink) Write(event Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.events = append(s.events, event)
+	if s.maxEvents > 0 && len(s.events) > s.maxEvents {
+		s.events = append([]Event{}, s.events[len(s.events)-s.maxEvents:]...)
+	}
+	return nil
+}
+
+func (s *memorySink) Query(q Query) (Page, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	q = q.normalized()
+	matching := []Event{}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if q.Matches(s.events[i]) {
+			matching = append(matching, s.events[i])
+		}
+	}
+	return pageOf(matching, q), nil
+}
+
+//JSONLinesSink appends one JSON event per line to the file, which also makes it easy to ship to a log pipeline.
+//Query reads the whole file so it is only suited to small logs.
+func JSONLinesSink(path string) *jsonLinesSink {
+	return &jsonLinesSink{path: path}
+}
+
+type jsonLinesSink struct {
+	lock sync.Mutex
+	path string
+}
+
+func (s *jsonLinesSink) Write(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal audit event")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open audit log file")
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return errors.Wrapf(err, "Failed to write audit event")
+	}
+	return nil
+}
+
+func (s *jsonLinesSink) Query(q Query) (Page, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q = q.normalized()
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pageOf(nil, q), nil
+		}
+		return Page{}, errors.Wrapf(err, "Failed to open audit log file")
+	}
+	defer f.Close()
+
+	matching := []Event{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			logrus.WithError(err).Warn("Skipping invalid audit log line")
+			continue
+		}
+		if q.Matches(event) {
+			matching = append(matching, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Page{}, errors.Wrapf(err, "Failed to read audit log file")
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].Time.After(matching[j].Time) })
+	return pageOf(matching, q), nil
+}
+
+//MongoSink stores events in the "audit_events" collection
+func MongoSink(m mongo.Mongo) *mongoSink {
+	s := &mongoSink{m}
+	indexes := []mgo.Index{
+		{Key: []string{"-time"}},
+		{Key: []string{"actor_id", "-time"}},
+		{Key: []string{"target_id", "-time"}},
+		{Key: []string{"action", "-time"}},
+	}
+	if err := m.EnsureIndexes(s.collection(), indexes); err != nil {
+		logrus.Panicf("Failed to ensure audit indexes, error: %s", err.Error())
+	}
+	return s
+}
+
+type mongoSink struct {
+	m mongo.Mongo
+}
+
+func (s *mongoSink) collection() *mgo.Collection { return s.m.Collection("audit_events") }
+
+func (s *mongoSink) Write(event Event) error {
+	return s.m.RefreshIfConnectionError(s.collection().Insert(event))
+}
+
+func (s *mongoSink) Query(q Query) (Page, error) {
+	q = q.normalized()
+
+	filter := bson.M{}
+	if q.Action != "" {
+		filter["action"] = q.Action
+	}
+	if q.Outcome != "" {
+		filter["outcome"] = q.Outcome
+	}
+	if q.ActorID != "" {
+		filter["actor_id"] = q.ActorID
+	}
+	if q.TargetID != "" {
+		filter["target_id"] = q.TargetID
+	}
+	if q.From != nil || q.To != nil {
+		timeFilter := bson.M{}
+		if q.From != nil {
+			timeFilter["$gte"] = *q.From
+		}
+		if q.To != nil {
+			timeFilter["$lt"] = *q.To
+		}
+		filter["time"] = timeFilter
+	}
+
+	query := s.collection().Find(filter)
+	total, err := query.Count()
+	if err != nil {
+		return Page{}, s.m.RefreshIfConnectionError(err)
+	}
+
+	events := []Event{}
+	if err := query.Sort("-time").Skip(q.Offset).Limit(q.Limit).All(&events); err != nil {
+		return Page{}, s.m.RefreshIfConnectionError(err)
+	}
+	return Page{Events: events, Total: total, Offset: q.Offset, Limit: q.Limit}, nil
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "net/http"
+
+//APIKeyAuthenticator authenticates machine clients with long-lived keys, as an alternative to tokens
+type APIKeyAuthenticator interface {
+	//AuthenticateRequest returns hasAPIKey=false if the request carries no API key at all
+	AuthenticateRequest(r *http.Request) (userID string, scopes []string, hasAPIKey bool, err error)
+}
+
+//APIKeys revokes the keys of a user along with their tokens, see the WithAPIKeys of Service
+type APIKeys interface {
+	RevokeAllForUser(userID string) error
+}
+
+type apiKeyPrincipal struct {
+	userID string
+	scopes []string
+	//scopesChecked is set by RequireScopes, LoadUser rejects API keys without it
+	scopesChecked bool
+}
+
+func (p apiKeyPrincipal) hasScope(scope string) bool {
+	for _, s := range p.scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
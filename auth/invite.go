@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/audit"
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/token"
+	"github.com/francoishill/gomponents/user"
+	"github.com/francoishill/gomponents/usertoken"
+)
+
+//An invite is pending until it is accepted. Accepting sets the password and verifies the email (the invite token was
+//delivered to it), so users with a verified email cannot be invited again.
+
+func (a *defaultService) Invite(user User) error {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+
+	if user.IsEmailVerified() {
+		return clienterror.NewError(errors.New("User already accepted the invite"), http.StatusConflict)
+	}
+
+	//only the latest invite token should be usable
+	if err := a.userTokens.RevokeAll(usertoken.PurposeInvite, user.ID()); err != nil {
+		userMessage := "Unable to revoke previous invite tokens"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	inviteToken, err := a.userTokens.Issue(usertoken.PurposeInvite, user.ID(), a.inviteTTL)
+	if err != nil {
+		userMessage := "Unable to generate invite token"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	if err := a.notifier.Invite(user, inviteToken); err != nil {
+		userMessage := "Unable to send invite"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	logger.Debug("Sent invite")
+	return nil
+}
+
+func (a *defaultService) ResendInvite(userID string) error {
+	user, err := a.getUser(userID)
+	if err != nil {
+		return err
+	}
+	return a.Invite(user)
+}
+
+func (a *defaultService) RevokeInvite(userID string) error {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", userID)
+
+	if err := a.userTokens.RevokeAll(usertoken.PurposeInvite, userID); err != nil {
+		userMessage := "Unable to revoke invite"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	logger.Debug("Revoked invite")
+	return nil
+}
+
+func (a *defaultService) AcceptInvite(ctx context.Context, inviteToken, password string) (invitee User, tokens token.Pair, err error) {
+	logger := logrus.NewEntry(logrus.StandardLogger())
+
+	//checked before the token is consumed so that a weak password does not burn the token
+	if err := a.ValidatePassword(password, nil); err != nil {
+		return nil, token.Pair{}, err
+	}
+
+	storedToken, err := a.userTokens.Consume(usertoken.PurposeInvite, inviteToken)
+	if err != nil {
+		logger.WithError(err).Error("Invite token rejected")
+		return nil, token.Pair{}, err
+	}
+	logger = logger.WithField("user-id", storedToken.UserID)
+	defer func() { a.auditResult(ctx, audit.ActionInviteAccept, storedToken.UserID, err) }()
+
+	invitee, err = a.getUser(storedToken.UserID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load user")
+		return nil, token.Pair{}, err
+	}
+	if invitee.Status() != user.StatusPendingVerification {
+		//like a user that was suspended before accepting the invite
+		if err = checkActive(logger, invitee); err != nil {
+			return nil, token.Pair{}, err
+		}
+	}
+	if err = a.ValidatePassword(password, invitee); err != nil {
+		return nil, token.Pair{}, err
+	}
+
+	passwordHash, err := a.encryption.HashPassword(password)
+	if err != nil {
+		userMessage := "Unable to hash password"
+		logger.WithError(err).Error(userMessage)
+		return nil, token.Pair{}, errors.New(userMessage)
+	}
+
+	userRepo := a.userRepoFactory.Repo()
+	if err = userRepo.SetPasswordHash(invitee.ID(), passwordHash); err != nil {
+		userMessage := "Failed to save password"
+		logger.WithError(err).Error(userMessage)
+		return nil, token.Pair{}, errors.New(userMessage)
+	}
+	if err = userRepo.SetEmailVerified(invitee.ID()); err != nil {
+		userMessage := "Failed to mark email as verified"
+		logger.WithError(err).Error(userMessage)
+		return nil, token.Pair{}, errors.New(userMessage)
+	}
+	if err = a.activatePending(logger, invitee.ID()); err != nil {
+		return nil, token.Pair{}, err
+	}
+
+	//reload to get the new password hash, verified email and status
+	if invitee, err = a.getUser(invitee.ID()); err != nil {
+		logger.WithError(err).Error("Failed to load user")
+		return nil, token.Pair{}, err
+	}
+
+	logger.Debug("Accepted invite")
+	if tokens, err = a.createTokens(ctx, logger, invitee); err != nil {
+		return nil, token.Pair{}, err
+	}
+	return invitee, tokens, nil
+}
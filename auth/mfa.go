@@ -0,0 +1,14 @@
+package auth
+
+//MFA is the second login factor, checked after the password (or magic token) matched
+type MFA interface {
+	IsEnabled(userID string) (bool, error)
+	Verify(userID, code string) error
+}
+
+//mfaRequiredError is returned by the login methods when the user still has to complete the second factor
+type mfaRequiredError struct {
+	pendingToken string
+}
+
+func (e *mfaRequiredError) Error() string { return "Multi-factor authentication is required" }
@@ -3,11 +3,15 @@ package auth
 import (
 	"context"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/middleware"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/francoishill/gomponents/audit"
 	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
 	"github.com/francoishill/gomponents/token"
 	"github.com/francoishill/gomponents/user"
 )
@@ -16,15 +20,37 @@ type Middleware interface {
 	Authenticate() []func(http.Handler) http.Handler
 	LoadUser() func(http.Handler) http.Handler
 	GetContextUser(ctx context.Context) user.User
+	//RequireVerifiedEmail rejects users that did not verify their email yet, it must be used after LoadUser
+	RequireVerifiedEmail() func(http.Handler) http.Handler
+	//RequireScopes rejects API key requests whose key lacks any of the scopes, token requests are not limited. It must
+	//be used between Authenticate and LoadUser, since LoadUser rejects API keys on routes that did not declare scopes.
+	RequireScopes(scopes ...string) func(http.Handler) http.Handler
+	//GetContextAPIKeyScopes returns the scopes of the API key that authenticated the request, isAPIKey is false for
+	//tokens (which are not limited by scopes)
+	GetContextAPIKeyScopes(ctx context.Context) (scopes []string, isAPIKey bool)
+	//GetContextOrgID returns the active organization loaded by LoadUser, it is empty if none was selected
+	GetContextOrgID(ctx context.Context) string
+	//GetContextSessionID returns the session loaded by LoadUser, it is empty for API keys and tokens without a session
+	GetContextSessionID(ctx context.Context) string
+	//GetContextActor returns the admin that is impersonating the user of GetContextUser, it is nil when not
+	//impersonating
+	GetContextActor(ctx context.Context) user.User
+	//RejectImpersonation rejects impersonated requests, for actions that would outlive the impersonation token or take
+	//over the account (like API keys, MFA, sessions and credentials), it must be used after LoadUser
+	RejectImpersonation() func(http.Handler) http.Handler
 }
 
 func DefaultMiddleware(userRepoFactory user.RepoFactory, rendering rendering.Service, token token.Service) *defaultMiddleware {
-	type ctxKey struct{}
+	type ctxKey struct{ name string }
 	return &defaultMiddleware{
-		userRepoFactory,
-		rendering,
-		token,
-		&ctxKey{},
+		userRepoFactory: userRepoFactory,
+		rendering:       rendering,
+		token:           token,
+		authUserCtxKey:  &ctxKey{"auth-user"},
+		apiKeyCtxKey:    &ctxKey{"api-key"},
+		orgIDCtxKey:     &ctxKey{"org-id"},
+		sessionIDCtxKey: &ctxKey{"session-id"},
+		actorCtxKey:     &ctxKey{"actor"},
 	}
 }
 
@@ -32,18 +58,82 @@ type defaultMiddleware struct {
 	userRepoFactory user.RepoFactory
 	rendering       rendering.Service
 	token           token.Service
+	apiKeys         APIKeyAuthenticator
+	sessions        Sessions
+	auditor         audit.Service
 
-	authUserCtxKey interface{}
+	authUserCtxKey  interface{}
+	apiKeyCtxKey    interface{}
+	orgIDCtxKey     interface{}
+	sessionIDCtxKey interface{}
+	actorCtxKey     interface{}
+}
+
+//WithAPIKeys makes Authenticate accept API keys as an alternative to tokens, only on routes that use RequireScopes
+func (m *defaultMiddleware) WithAPIKeys(apiKeys APIKeyAuthenticator) *defaultMiddleware {
+	m.apiKeys = apiKeys
+	return m
+}
+
+//WithAudit records every impersonated request that is not read-only, impersonation tokens are rejected without it
+func (m *defaultMiddleware) WithAudit(auditor audit.Service) *defaultMiddleware {
+	m.auditor = auditor
+	return m
+}
+
+//WithSessions makes LoadUser reject tokens of ended sessions
+func (m *defaultMiddleware) WithSessions(sessions Sessions) *defaultMiddleware {
+	m.sessions = sessions
+	return m
 }
 
 func (m *defaultMiddleware) Authenticate() []func(http.Handler) http.Handler {
-	return m.token.Middlewares()
+	if m.apiKeys == nil {
+		return m.token.Middlewares()
+	}
+	return []func(http.Handler) http.Handler{m.authenticateAPIKeyOrToken}
+}
+
+func (m *defaultMiddleware) authenticateAPIKeyOrToken(next http.Handler) http.Handler {
+	tokenMiddlewares := m.token.Middlewares()
+	tokenHandler := next
+	for i := len(tokenMiddlewares) - 1; i >= 0; i-- {
+		tokenHandler = tokenMiddlewares[i](tokenHandler)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, scopes, hasAPIKey, err := m.apiKeys.AuthenticateRequest(r)
+		if !hasAPIKey {
+			tokenHandler.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			m.rendering.RenderError(w, r, errors.Wrapf(err, "Invalid API key"), nil, http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), m.apiKeyCtxKey, apiKeyPrincipal{userID: userID, scopes: scopes})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (m *defaultMiddleware) contextUserID(ctx context.Context) (string, error) {
+	if principal, ok := ctx.Value(m.apiKeyCtxKey).(apiKeyPrincipal); ok {
+		return principal.userID, nil
+	}
+	return m.token.UserIDFromContext(ctx)
 }
 
 func (m *defaultMiddleware) LoadUser() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID, err := m.token.UserIDFromContext(r.Context())
+			//API keys are denied by default, so that a key cannot do everything its user can
+			if principal, isAPIKey := r.Context().Value(m.apiKeyCtxKey).(apiKeyPrincipal); isAPIKey && !principal.scopesChecked {
+				m.rendering.RenderError(w, r, errors.New("API keys are not accepted for this action"), nil, http.StatusForbidden)
+				return
+			}
+
+			userID, err := m.contextUserID(r.Context())
 			if err != nil {
 				userMessage := "Failed to get user ID from context"
 				logrus.WithError(err).Error(userMessage)
@@ -51,18 +141,186 @@ func (m *defaultMiddleware) LoadUser() func(http.Handler) http.Handler {
 				return
 			}
 
+			ctx := r.Context()
+			if sessionID, ok := m.contextSessionID(ctx); ok {
+				if err := m.sessions.Check(request.ClientContext(r), sessionID, userID); err != nil {
+					m.rendering.RenderError(w, r, errors.Wrapf(err, "Session is no longer valid"), nil, http.StatusUnauthorized)
+					return
+				}
+				ctx = context.WithValue(ctx, m.sessionIDCtxKey, sessionID)
+			}
+
 			user, err := m.userRepoFactory.Repo().Get(userID)
 			if err != nil {
 				m.rendering.RenderError(w, r, errors.Wrapf(err, "Failed to get user"), nil, http.StatusInternalServerError)
 				return
 			}
+			//tokens are revoked when an account stops being active, but API keys and tokens without a revocation
+			//store are not
+			if err := user.Status().CheckActive(); err != nil {
+				m.rendering.RenderError(w, r, err, nil, http.StatusForbidden)
+				return
+			}
+
+			ctx = context.WithValue(ctx, m.authUserCtxKey, user)
+			if actorID, isImpersonating := m.contextActorID(ctx); isImpersonating {
+				actor, err := m.userRepoFactory.Repo().Get(actorID)
+				if err != nil {
+					m.rendering.RenderError(w, r, errors.Wrapf(err, "Failed to get impersonating user"), nil, http.StatusInternalServerError)
+					return
+				}
+				//the actor may have lost admin permission since the token was issued
+				if !actor.IsAdmin() {
+					m.rendering.RenderError(w, r, errors.New("Impersonation is no longer allowed"), nil, http.StatusUnauthorized)
+					return
+				}
+				if m.auditor == nil {
+					logrus.WithField("actor-id", actorID).WithField("user-id", userID).Error("Impersonation token rejected, no audit log is set")
+					m.rendering.RenderError(w, r, errors.New("Impersonation is not allowed without an audit log"), nil, http.StatusUnauthorized)
+					return
+				}
+				logrus.
+					WithField("actor-id", actorID).
+					WithField("user-id", userID).
+					WithField("method", r.Method).
+					WithField("path", r.URL.Path).
+					Info("Impersonated request")
+				ctx = context.WithValue(ctx, m.actorCtxKey, actor)
+			}
+			if orgID, ok := m.token.ClaimFromContext(ctx, OrgIDClaim); ok {
+				if orgIDStr, isStr := orgID.(string); isStr {
+					ctx = context.WithValue(ctx, m.orgIDCtxKey, orgIDStr)
+				}
+			}
 
-			ctx := context.WithValue(r.Context(), m.authUserCtxKey, user)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			actor := m.GetContextActor(ctx)
+			if actor == nil || isReadOnly(r.Method) {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+			m.recordImpersonated(r.WithContext(ctx), actor.ID(), userID, ww.Status())
 		})
 	}
 }
 
+//contextSessionID is false if sessions are not enabled or the token has no session (like tokens issued before
+//sessions were enabled)
+func (m *defaultMiddleware) contextSessionID(ctx context.Context) (string, bool) {
+	if m.sessions == nil {
+		return "", false
+	}
+	if _, isAPIKey := ctx.Value(m.apiKeyCtxKey).(apiKeyPrincipal); isAPIKey {
+		return "", false
+	}
+	sessionID, ok := m.token.ClaimFromContext(ctx, SessionIDClaim)
+	if !ok {
+		return "", false
+	}
+	sessionIDStr, _ := sessionID.(string)
+	return sessionIDStr, true
+}
+
+//contextActorID is false if the token is not an impersonation token
+func (m *defaultMiddleware) contextActorID(ctx context.Context) (string, bool) {
+	act, ok := m.token.ClaimFromContext(ctx, ActorClaim)
+	if !ok {
+		return "", false
+	}
+	actMap, _ := act.(map[string]interface{})
+	actorID, _ := actMap["sub"].(string)
+	return actorID, true
+}
+
 func (m *defaultMiddleware) GetContextUser(ctx context.Context) user.User {
 	return ctx.Value(m.authUserCtxKey).(user.User)
 }
+
+func (m *defaultMiddleware) GetContextOrgID(ctx context.Context) string {
+	orgID, _ := ctx.Value(m.orgIDCtxKey).(string)
+	return orgID
+}
+
+func (m *defaultMiddleware) GetContextSessionID(ctx context.Context) string {
+	sessionID, _ := ctx.Value(m.sessionIDCtxKey).(string)
+	return sessionID
+}
+
+func (m *defaultMiddleware) GetContextAPIKeyScopes(ctx context.Context) ([]string, bool) {
+	principal, isAPIKey := ctx.Value(m.apiKeyCtxKey).(apiKeyPrincipal)
+	return principal.scopes, isAPIKey
+}
+
+func (m *defaultMiddleware) GetContextActor(ctx context.Context) user.User {
+	actor, _ := ctx.Value(m.actorCtxKey).(user.User)
+	return actor
+}
+
+func (m *defaultMiddleware) RequireVerifiedEmail() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := m.GetContextUser(r.Context())
+			if !user.IsEmailVerified() {
+				m.rendering.RenderError(w, r, errors.Errorf("Email verification is required for this action"), nil, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (m *defaultMiddleware) RejectImpersonation() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if m.GetContextActor(r.Context()) != nil {
+				m.rendering.RenderError(w, r, errors.New("This action is not allowed while impersonating"), nil, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//recordImpersonated audits a request made by actorID as userID, LoadUser makes sure the auditor is set
+func (m *defaultMiddleware) recordImpersonated(r *http.Request, actorID, userID string, status int) {
+	outcome := audit.OutcomeSuccess
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		outcome = audit.OutcomeDenied
+	case status >= 400:
+		outcome = audit.OutcomeFailure
+	}
+	event := audit.NewEvent(request.ClientContext(r), audit.ActionImpersonatedRequest, outcome, actorID, userID).
+		WithDetail("method", r.Method).
+		WithDetail("path", r.URL.Path).
+		WithDetail("status", strconv.Itoa(status))
+	m.auditor.Record(event)
+}
+
+func isReadOnly(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func (m *defaultMiddleware) RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, isAPIKey := r.Context().Value(m.apiKeyCtxKey).(apiKeyPrincipal)
+			if !isAPIKey {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, scope := range scopes {
+				if !principal.hasScope(scope) {
+					m.rendering.RenderError(w, r, errors.Errorf("API key scope '%s' is required for this action", scope), nil, http.StatusForbidden)
+					return
+				}
+			}
+			principal.scopesChecked = true
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), m.apiKeyCtxKey, principal)))
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package auth
+
+//Notifier delivers secrets out-of-band (like by email) to the user they belong to
+type Notifier interface {
+	PasswordReset(user User, resetToken string) error
+	VerifyEmail(user User, verificationToken string) error
+	MagicLogin(user User, magicToken string) error
+	Invite(user User, inviteToken string) error
+}
@@ -0,0 +1,8 @@
+package auth
+
+import "github.com/francoishill/gomponents/user"
+
+//PasswordPolicy rejects weak passwords, user is nil when it is not known yet
+type PasswordPolicy interface {
+	Validate(password string, user user.User) error
+}
@@ -1,30 +1,130 @@
 package auth
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/francoishill/gomponents/audit"
 	"github.com/francoishill/gomponents/clienterror"
 	"github.com/francoishill/gomponents/encryption"
+	"github.com/francoishill/gomponents/lockout"
 	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
 	"github.com/francoishill/gomponents/token"
 	"github.com/francoishill/gomponents/user"
+	"github.com/francoishill/gomponents/usertoken"
 )
 
 type Service interface {
-	Register(user User) (token string, err error)
-	Login(user User, password string) (token string, err error)
-	MagicLogin(user User, magicToken string) (token string, err error)
+	//Register checks password (which must match the hash of user) against the password policy. The user must have
+	//user.StatusPendingVerification if EmailVerificationRequired.
+	Register(ctx context.Context, user User, password string) (tokens token.Pair, err error)
+	Login(ctx context.Context, user User, password string) (tokens token.Pair, err error)
+	//LoginUnknownUser counts a login for a user that could not be loaded (loadErr, like an unknown email) towards the
+	//per-IP lockout like a wrong password. It returns the error to render, which is the same as for a wrong password
+	//so that it does not tell which accounts exist.
+	LoginUnknownUser(ctx context.Context, loadErr error) error
+	RequestMagicLogin(user User) error
+	MagicLogin(ctx context.Context, user User, magicToken string) (tokens token.Pair, err error)
+	//ExternalLogin logs in a user that was authenticated by an external identity provider (like OpenID Connect)
+	ExternalLogin(ctx context.Context, user User) (tokens token.Pair, err error)
+	//IsMFARequiredErr reports whether a login error means the second factor is still required, the pending token
+	//must then be passed to VerifyMFA along with the code
+	IsMFARequiredErr(err error) (pendingToken string, isMFARequired bool)
+	//VerifyMFA completes the login, the pending token is used up by the first valid code
+	VerifyMFA(ctx context.Context, pendingToken, code string) (user User, tokens token.Pair, err error)
+	//Refresh swaps a refresh token for a new token pair, see token.Service.Refresh
+	Refresh(ctx context.Context, refreshToken string) (user User, tokens token.Pair, err error)
+	//Logout revokes the token of the authenticated request
+	Logout(ctx context.Context) error
+	//RevokeAllTokens also revokes the API keys of the user (see WithAPIKeys)
+	RevokeAllTokens(userID string) error
+	UnlockUser(userID string) error
+	//ChangeStatus moves the account to status if the transition is allowed (see user.Status), all tokens of the user
+	//are revoked when the account stops being active
+	ChangeStatus(userID string, status user.Status) (previous user.Status, err error)
+	//SwitchOrg creates a token pair with orgID as the active organization (OrgIDClaim), the caller must check the
+	//membership first. An empty orgID clears the active organization.
+	SwitchOrg(ctx context.Context, user User, orgID string) (tokens token.Pair, err error)
+	//Impersonate creates a short-lived access token (no refresh token) for the target user that carries the actor in
+	//the ActorClaim, see Middleware.GetContextActor
+	Impersonate(ctx context.Context, actor user.User, targetUserID string) (accessToken string, expiresAt time.Time, err error)
+
+	//Invite sends an invite token (see Notifier) to a user that was added without a password, accepting it sets the
+	//password. It fails for users that already accepted.
+	Invite(user User) error
+	ResendInvite(userID string) error
+	//RevokeInvite makes the pending invite tokens of the user unusable
+	RevokeInvite(userID string) error
+	AcceptInvite(ctx context.Context, inviteToken, password string) (user User, tokens token.Pair, err error)
+
+	ForgotPassword(user User) error
+	//ResetPassword revokes all tokens (and API keys) of the user
+	ResetPassword(resetToken, newPassword string) error
+	//ConfirmPassword re-checks the password of an authenticated user before a sensitive action, failures count
+	//towards the lockout. It fails while impersonating (see Impersonate), like ChangePassword.
+	ConfirmPassword(ctx context.Context, user User, password string) error
+	//ChangePassword revokes all tokens (and API keys) of the user, so all devices (including the current one) must log
+	//in again
+	ChangePassword(ctx context.Context, user User, currentPassword, newPassword string) error
+	//ChangeEmail saves updatedUser (the user with the new email) after confirming the password, both must be an
+	//EmailUser. The new address is not verified, a verification is sent if EmailVerificationRequired and the password
+	//reset and magic login tokens sent to the old address are revoked.
+	ChangeEmail(ctx context.Context, user User, currentPassword string, updatedUser User) (changedUser User, verificationSent bool, err error)
+	//SetEmail is ChangeEmail without the password confirmation, for admins changing the email of another user
+	SetEmail(user User, updatedUser User) (changedUser User, verificationSent bool, err error)
+	//ValidatePassword checks a new password against the password policy (if any), user may be nil
+	ValidatePassword(password string, user user.User) error
+
+	EmailVerificationRequired() bool
+	SendEmailVerification(user User) error
+	VerifyEmail(verificationToken string) error
 }
 
-func DefaultService(userRepoFactory user.RepoFactory, rendering rendering.Service, encryption encryption.Service, token token.Service) *defaultService {
+const (
+	DefaultPasswordResetTTL     = time.Hour
+	DefaultEmailVerificationTTL = 48 * time.Hour
+	DefaultMagicLoginTTL        = 15 * time.Minute
+	DefaultMFAPendingTTL        = 5 * time.Minute
+	DefaultImpersonationTTL     = 15 * time.Minute
+	DefaultInviteTTL            = 7 * 24 * time.Hour
+
+	//OrgIDClaim is the access token claim holding the active organization, see Middleware.GetContextOrgID
+	OrgIDClaim = "org_id"
+	//ActorClaim holds the admin that is impersonating the user, as {"sub": "<actor user ID>"} (RFC 8693)
+	ActorClaim = "act"
+
+	emailVerificationPurpose = "email-verification"
+	mfaPendingPurpose        = "mfa-pending"
+
+	//emailHashClaim binds an email verification token to the address it was sent to
+	emailHashClaim = "email_hash"
+	//mfaPendingIDClaim is the single-use user token (usertoken.PurposeMFAPending) of an MFA pending token
+	mfaPendingIDClaim = "jti"
+)
+
+func DefaultService(
+	userRepoFactory user.RepoFactory, rendering rendering.Service, encryption encryption.Service, token token.Service,
+	userTokens usertoken.Service, notifier Notifier) *defaultService {
+
 	return &defaultService{
-		userRepoFactory,
-		rendering,
-		encryption,
-		token,
+		userRepoFactory:      userRepoFactory,
+		rendering:            rendering,
+		encryption:           encryption,
+		token:                token,
+		userTokens:           userTokens,
+		notifier:             notifier,
+		passwordResetTTL:     DefaultPasswordResetTTL,
+		emailVerificationTTL: DefaultEmailVerificationTTL,
+		magicLoginTTL:        DefaultMagicLoginTTL,
+		inviteTTL:            DefaultInviteTTL,
 	}
 }
 
@@ -33,76 +133,966 @@ type defaultService struct {
 	rendering       rendering.Service
 	encryption      encryption.Service
 	token           token.Service
+	userTokens      usertoken.Service
+	notifier        Notifier
+
+	passwordResetTTL time.Duration
+	magicLoginTTL    time.Duration
+	inviteTTL        time.Duration
+
+	requireEmailVerification bool
+	emailVerificationTTL     time.Duration
+
+	mfa           MFA
+	mfaPendingTTL time.Duration
+
+	lockout lockout.Service
+
+	sessions Sessions
+
+	apiKeys APIKeys
+
+	impersonationEnabled     bool
+	impersonationTTL         time.Duration
+	impersonateAdminsAllowed bool
+
+	auditor audit.Service
+
+	passwordPolicy PasswordPolicy
+}
+
+//WithPasswordResetTTL overrides how long a password reset token stays valid (DefaultPasswordResetTTL)
+func (a *defaultService) WithPasswordResetTTL(ttl time.Duration) *defaultService {
+	a.passwordResetTTL = ttl
+	return a
+}
+
+//WithMagicLoginTTL overrides how long a magic login token stays valid (DefaultMagicLoginTTL)
+func (a *defaultService) WithMagicLoginTTL(ttl time.Duration) *defaultService {
+	a.magicLoginTTL = ttl
+	return a
+}
+
+//WithInviteTTL overrides how long an invite token stays valid (DefaultInviteTTL)
+func (a *defaultService) WithInviteTTL(ttl time.Duration) *defaultService {
+	a.inviteTTL = ttl
+	return a
+}
+
+//WithMFA makes Login and MagicLogin return a short-lived "mfa pending" token (instead of the access token) for
+//users that enabled MFA, a zero ttl uses DefaultMFAPendingTTL
+func (a *defaultService) WithMFA(mfa MFA, pendingTTL time.Duration) *defaultService {
+	a.mfa = mfa
+	a.mfaPendingTTL = pendingTTL
+	if a.mfaPendingTTL <= 0 {
+		a.mfaPendingTTL = DefaultMFAPendingTTL
+	}
+	return a
+}
+
+//WithLockout throttles failed password, magic token and MFA attempts per user and per client IP
+func (a *defaultService) WithLockout(lockout lockout.Service) *defaultService {
+	a.lockout = lockout
+	return a
 }
 
-func (a *defaultService) Register(u User) (token string, err error) {
+//WithSessions records a session for every login, Refresh fails once the session is ended
+func (a *defaultService) WithSessions(sessions Sessions) *defaultService {
+	a.sessions = sessions
+	return a
+}
+
+//WithAPIKeys revokes the API keys of a user in RevokeAllTokens, ResetPassword and ChangePassword, so that a key
+//created by whoever took over the account does not survive
+func (a *defaultService) WithAPIKeys(apiKeys APIKeys) *defaultService {
+	a.apiKeys = apiKeys
+	return a
+}
+
+//WithImpersonation allows admins to impersonate users, other admins can only be impersonated if allowAdminTargets.
+//A zero ttl uses DefaultImpersonationTTL. Impersonation also requires WithAudit (and the WithAudit of the
+//middleware), so that it is always audited.
+func (a *defaultService) WithImpersonation(ttl time.Duration, allowAdminTargets bool) *defaultService {
+	a.impersonationEnabled = true
+	a.impersonationTTL = ttl
+	if a.impersonationTTL <= 0 {
+		a.impersonationTTL = DefaultImpersonationTTL
+	}
+	a.impersonateAdminsAllowed = allowAdminTargets
+	return a
+}
+
+//WithAudit records logins, registrations, password resets, accepted invites and impersonations
+func (a *defaultService) WithAudit(auditor audit.Service) *defaultService {
+	a.auditor = auditor
+	return a
+}
+
+//WithPasswordPolicy checks new passwords in Register, ChangePassword and ResetPassword
+func (a *defaultService) WithPasswordPolicy(policy PasswordPolicy) *defaultService {
+	a.passwordPolicy = policy
+	return a
+}
+
+//WithEmailVerification makes Register send a verification token instead of logging the (unverified) user in,
+//a zero ttl keeps DefaultEmailVerificationTTL
+func (a *defaultService) WithEmailVerification(ttl time.Duration) *defaultService {
+	a.requireEmailVerification = true
+	if ttl > 0 {
+		a.emailVerificationTTL = ttl
+	}
+	return a
+}
+
+func (a *defaultService) Register(ctx context.Context, u User, password string) (tokens token.Pair, err error) {
 	logger := logrus.NewEntry(logrus.StandardLogger())
+	defer func() { a.auditResult(ctx, audit.ActionRegister, u.ID(), err) }()
+
+	if err = a.ValidatePassword(password, u); err != nil {
+		return token.Pair{}, err
+	}
+	//added as pending right away, so that the user cannot authenticate before verifying
+	if a.requireEmailVerification && u.Status() != user.StatusPendingVerification {
+		userMessage := "New user must be pending verification"
+		logger.WithField("status", u.Status()).Error(userMessage)
+		return token.Pair{}, errors.New(userMessage)
+	}
 
 	userRepo := a.userRepoFactory.Repo()
 	if err = userRepo.Add(u); err != nil {
 		if userRepo.IsDupErr(err) {
 			userMessage := "Failed to add new user, user already exists"
 			logger.WithError(err).Error(userMessage)
-			return "", clienterror.NewErrorDefaultStatus(errors.New(userMessage))
+			return token.Pair{}, clienterror.NewErrorDefaultStatus(errors.New(userMessage))
 		}
 		userMessage := "Failed to add new user"
 		logger.WithError(err).Error(userMessage)
-		return "", errors.New(userMessage)
+		return token.Pair{}, errors.New(userMessage)
 	}
 
-	token, err = a.token.Create(u)
-	if err != nil {
-		userMessage := "Unable to generate token"
-		logger.WithError(err).Error(userMessage)
-		return "", errors.New(userMessage)
+	if a.requireEmailVerification {
+		if err := a.SendEmailVerification(u); err != nil {
+			return token.Pair{}, err
+		}
+		logger.Debug("Registered user pending email verification")
+		return token.Pair{}, nil
 	}
 
-	logger.Debug("Created token")
-	return token, nil
+	return a.createTokens(ctx, logger, u)
 }
 
-func (a *defaultService) Login(user User, password string) (token string, err error) {
+func (a *defaultService) Login(ctx context.Context, user User, password string) (tokens token.Pair, err error) {
 	logger := logrus.NewEntry(logrus.StandardLogger())
+	defer func() { a.auditResult(ctx, audit.ActionLogin, user.ID(), err) }()
+
+	if err := a.checkLockout(ctx, logger, user.ID()); err != nil {
+		return token.Pair{}, err
+	}
 
 	if err := a.encryption.VerifyPassword(password, user.PasswordHash()); err != nil {
 		logger.WithError(err).Error("User password mismatch")
-		return "", errors.New("User email or password is incorrect")
+		a.recordFailure(ctx, logger, user.ID())
+		return token.Pair{}, errors.New("User email or password is incorrect")
 	}
 	logger = logger.WithField("user-id", user.ID())
+	a.recordSuccess(ctx, logger, user.ID())
+
+	return a.completeLogin(ctx, logger, user)
+}
 
-	token, err = a.token.Create(user)
+func (a *defaultService) LoginUnknownUser(ctx context.Context, loadErr error) (err error) {
+	logger := logrus.NewEntry(logrus.StandardLogger())
+	defer func() { a.auditResult(ctx, audit.ActionLogin, "", err) }()
+
+	logger.WithError(loadErr).Warn("Login for unknown user")
+	if err := a.checkLockout(ctx, logger, ""); err != nil {
+		return err
+	}
+	a.recordFailure(ctx, logger, "")
+	return errors.New("User email or password is incorrect")
+}
+
+func (a *defaultService) RequestMagicLogin(user User) error {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+
+	//only the latest magic login token should be usable
+	if err := a.userTokens.RevokeAll(usertoken.PurposeMagicLogin, user.ID()); err != nil {
+		userMessage := "Unable to revoke previous magic login tokens"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	magicToken, err := a.userTokens.Issue(usertoken.PurposeMagicLogin, user.ID(), a.magicLoginTTL)
 	if err != nil {
-		userMessage := "Unable to generate token"
+		userMessage := "Unable to generate magic login token"
 		logger.WithError(err).Error(userMessage)
-		return "", errors.New(userMessage)
+		return errors.New(userMessage)
 	}
 
-	logger.Debug("Created token")
-	return token, nil
+	if err := a.notifier.MagicLogin(user, magicToken); err != nil {
+		userMessage := "Unable to send magic login token"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	logger.Debug("Sent magic login token")
+	return nil
 }
 
-func (a *defaultService) MagicLogin(user User, magicToken string) (token string, err error) {
+func (a *defaultService) MagicLogin(ctx context.Context, user User, magicToken string) (tokens token.Pair, err error) {
 	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+	defer func() { a.auditResult(ctx, audit.ActionMagicLogin, user.ID(), err) }()
 
-	if user.MagicLoginToken() == nil {
-		userMessage := fmt.Sprintf("Magic Token Login is not allowed for user with userID '%s' (since MagicLoginToken == NIL)", user.ID())
-		logger.Error(userMessage)
-		return "", errors.New(userMessage)
+	if err := a.checkLockout(ctx, logger, user.ID()); err != nil {
+		return token.Pair{}, err
+	}
+
+	storedToken, err := a.userTokens.Consume(usertoken.PurposeMagicLogin, magicToken)
+	if err != nil {
+		logger.WithError(err).Error("Magic login token rejected")
+		a.recordFailure(ctx, logger, user.ID())
+		return token.Pair{}, err
 	}
 
-	if *user.MagicLoginToken() != magicToken {
+	if subtle.ConstantTimeCompare([]byte(storedToken.UserID), []byte(user.ID())) != 1 {
 		userMessage := fmt.Sprintf("Token mismatch of user with userID '%s'", user.ID())
 		logger.Error(userMessage)
-		return "", errors.New(userMessage)
+		a.recordFailure(ctx, logger, user.ID())
+		return token.Pair{}, clienterror.NewError(errors.New(userMessage), http.StatusUnauthorized)
+	}
+	a.recordSuccess(ctx, logger, user.ID())
+
+	return a.completeLogin(ctx, logger, user)
+}
+
+func (a *defaultService) ExternalLogin(ctx context.Context, user User) (tokens token.Pair, err error) {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+	defer func() { a.auditResult(ctx, audit.ActionExternalLogin, user.ID(), err) }()
+
+	if err := a.checkLockout(ctx, logger, user.ID()); err != nil {
+		return token.Pair{}, err
+	}
+
+	return a.completeLogin(ctx, logger, user)
+}
+
+//completeLogin creates the access token, or the pending token when the user still has to pass MFA
+func (a *defaultService) completeLogin(ctx context.Context, logger *logrus.Entry, user User) (token.Pair, error) {
+	if err := checkActive(logger, user); err != nil {
+		return token.Pair{}, err
+	}
+
+	if a.mfa != nil {
+		mfaEnabled, err := a.mfa.IsEnabled(user.ID())
+		if err != nil {
+			userMessage := "Unable to check multi-factor authentication"
+			logger.WithError(err).Error(userMessage)
+			return token.Pair{}, errors.New(userMessage)
+		}
+
+		if mfaEnabled {
+			//the pending token can only be used once, VerifyMFA consumes its id
+			pendingID, err := a.userTokens.Issue(usertoken.PurposeMFAPending, user.ID(), a.mfaPendingTTL)
+			if err != nil {
+				userMessage := "Unable to generate multi-factor authentication token"
+				logger.WithError(err).Error(userMessage)
+				return token.Pair{}, errors.New(userMessage)
+			}
+			extraClaims := map[string]interface{}{mfaPendingIDClaim: pendingID}
+			pendingToken, err := a.token.CreateSignedWithClaims(mfaPendingPurpose, user.ID(), extraClaims, a.mfaPendingTTL)
+			if err != nil {
+				userMessage := "Unable to generate multi-factor authentication token"
+				logger.WithError(err).Error(userMessage)
+				return token.Pair{}, errors.New(userMessage)
+			}
+
+			logger.Debug("Created MFA pending token")
+			return token.Pair{}, &mfaRequiredError{pendingToken}
+		}
+	}
+
+	return a.createTokens(ctx, logger, user)
+}
+
+func (a *defaultService) SwitchOrg(ctx context.Context, user User, orgID string) (token.Pair, error) {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID()).WithField("org-id", orgID)
+
+	//would turn the short-lived impersonation token into a refreshable pair
+	if a.isImpersonating(ctx) {
+		return token.Pair{}, clienterror.NewError(errors.New("Cannot switch organization while impersonating"), http.StatusForbidden)
+	}
+
+	claims := map[string]interface{}{}
+	if orgID != "" {
+		claims[OrgIDClaim] = orgID
+	}
+	//switching keeps the current session
+	if sessionID, ok := a.token.ClaimFromContext(ctx, SessionIDClaim); ok {
+		claims[SessionIDClaim] = sessionID
+	}
+	return a.createTokensWithClaims(ctx, logger, user, claims)
+}
+
+func (a *defaultService) Impersonate(ctx context.Context, actor user.User, targetUserID string) (accessToken string, expiresAt time.Time, err error) {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("actor-id", actor.ID()).WithField("user-id", targetUserID)
+	defer func() {
+		if a.auditor == nil {
+			return
+		}
+		event := audit.NewEvent(ctx, audit.ActionImpersonate, audit.OutcomeSuccess, actor.ID(), targetUserID)
+		if err != nil {
+			event.Outcome = audit.OutcomeFailure
+			if clientErr, ok := err.(clienterror.Error); ok && clientErr.Status() == http.StatusForbidden {
+				event.Outcome = audit.OutcomeDenied
+			}
+			event = event.WithReason(err.Error())
+		} else {
+			event = event.WithDetail("expires_at", expiresAt.Format(time.RFC3339))
+		}
+		a.auditor.Record(event)
+	}()
+
+	if !a.impersonationEnabled {
+		return "", time.Time{}, clienterror.NewError(errors.New("Impersonation is not enabled"), http.StatusBadRequest)
+	}
+	if a.auditor == nil {
+		userMessage := "Impersonation is not allowed without an audit log"
+		logger.Error(userMessage)
+		return "", time.Time{}, errors.New(userMessage)
+	}
+	if !actor.IsAdmin() {
+		return "", time.Time{}, clienterror.NewError(errors.New("Admin permission is required to impersonate"), http.StatusForbidden)
+	}
+	if a.isImpersonating(ctx) {
+		return "", time.Time{}, clienterror.NewError(errors.New("Cannot impersonate while impersonating"), http.StatusForbidden)
+	}
+	if actor.ID() == targetUserID {
+		return "", time.Time{}, clienterror.NewError(errors.New("Cannot impersonate yourself"), http.StatusBadRequest)
+	}
+
+	target, err := a.getUser(targetUserID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load user to impersonate")
+		return "", time.Time{}, err
+	}
+	if target.IsAdmin() && !a.impersonateAdminsAllowed {
+		logger.Warn("Impersonation of admin denied")
+		return "", time.Time{}, clienterror.NewError(errors.New("Impersonating admins is not allowed"), http.StatusForbidden)
+	}
+
+	claims := map[string]interface{}{
+		ActorClaim: map[string]interface{}{"sub": actor.ID()},
+	}
+	expiresAt = time.Now().Add(a.impersonationTTL)
+	accessToken, err = a.token.CreateWithClaims(target, claims, a.impersonationTTL)
+	if err != nil {
+		userMessage := "Unable to generate impersonation token"
+		logger.WithError(err).Error(userMessage)
+		return "", time.Time{}, errors.New(userMessage)
 	}
 
-	token, err = a.token.Create(user)
+	client := request.ClientInfoFromContext(ctx)
+	logger.WithField("ip", client.IP).WithField("request-id", client.RequestID).WithField("expires-at", expiresAt).Warn("Impersonation started")
+	return accessToken, expiresAt, nil
+}
+
+func (a *defaultService) isImpersonating(ctx context.Context) bool {
+	_, isImpersonating := a.token.ClaimFromContext(ctx, ActorClaim)
+	return isImpersonating
+}
+
+func (a *defaultService) createTokens(ctx context.Context, logger *logrus.Entry, user User) (token.Pair, error) {
+	return a.createTokensWithClaims(ctx, logger, user, map[string]interface{}{})
+}
+
+//createTokensWithClaims starts a new session, unless claims already has one
+func (a *defaultService) createTokensWithClaims(ctx context.Context, logger *logrus.Entry, user User, claims map[string]interface{}) (token.Pair, error) {
+	if err := checkActive(logger, user); err != nil {
+		return token.Pair{}, err
+	}
+	if _, hasSession := claims[SessionIDClaim]; a.sessions != nil && !hasSession {
+		sessionID, err := a.sessions.Start(ctx, user.ID())
+		if err != nil {
+			userMessage := "Unable to start session"
+			logger.WithError(err).Error(userMessage)
+			return token.Pair{}, errors.New(userMessage)
+		}
+		claims[SessionIDClaim] = sessionID
+		logger = logger.WithField("session-id", sessionID)
+	}
+
+	tokens, err := a.token.CreatePairWithClaims(user, claims)
 	if err != nil {
 		userMessage := "Unable to generate token"
 		logger.WithError(err).Error(userMessage)
-		return "", errors.New(userMessage)
+		return token.Pair{}, errors.New(userMessage)
 	}
 
 	logger.Debug("Created token")
-	return token, nil
+	return tokens, nil
+}
+
+func (a *defaultService) IsMFARequiredErr(err error) (string, bool) {
+	if mfaErr, ok := err.(*mfaRequiredError); ok {
+		return mfaErr.pendingToken, true
+	}
+	return "", false
+}
+
+func (a *defaultService) VerifyMFA(ctx context.Context, pendingToken, code string) (user User, tokens token.Pair, err error) {
+	logger := logrus.NewEntry(logrus.StandardLogger())
+
+	if a.mfa == nil {
+		return nil, token.Pair{}, clienterror.NewError(errors.New("Multi-factor authentication is not enabled"), http.StatusBadRequest)
+	}
+
+	invalidTokenMessage := "Invalid or expired multi-factor authentication token"
+	userID, claims, err := a.token.ParseSignedWithClaims(mfaPendingPurpose, pendingToken)
+	if err != nil {
+		logger.WithError(err).Error(invalidTokenMessage)
+		return nil, token.Pair{}, clienterror.NewError(errors.New(invalidTokenMessage), http.StatusUnauthorized)
+	}
+	pendingID, _ := claims[mfaPendingIDClaim].(string)
+	logger = logger.WithField("user-id", userID)
+	defer func() { a.auditResult(ctx, audit.ActionMFA, userID, err) }()
+
+	if err := a.checkLockout(ctx, logger, userID); err != nil {
+		return nil, token.Pair{}, err
+	}
+	if err := a.mfa.Verify(userID, code); err != nil {
+		logger.WithError(err).Error("Multi-factor authentication code rejected")
+		a.recordFailure(ctx, logger, userID)
+		return nil, token.Pair{}, err
+	}
+	a.recordSuccess(ctx, logger, userID)
+
+	//consumed only after a valid code, so that a mistyped code does not require the password again
+	storedPending, err := a.userTokens.Consume(usertoken.PurposeMFAPending, pendingID)
+	if err != nil || storedPending.UserID != userID {
+		logger.WithError(err).Error("Multi-factor authentication token was already used")
+		return nil, token.Pair{}, clienterror.NewError(errors.New(invalidTokenMessage), http.StatusUnauthorized)
+	}
+
+	user, err = a.getUser(userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load user")
+		return nil, token.Pair{}, err
+	}
+
+	tokens, err = a.createTokens(ctx, logger, user)
+	if err != nil {
+		return nil, token.Pair{}, err
+	}
+	return user, tokens, nil
+}
+
+func (a *defaultService) Refresh(ctx context.Context, refreshToken string) (User, token.Pair, error) {
+	logger := logrus.NewEntry(logrus.StandardLogger())
+
+	var authUser User
+	var sessionID string
+	tokens, err := a.token.Refresh(refreshToken, func(userID string, claims map[string]interface{}) (user.User, error) {
+		if err := a.checkSession(ctx, userID, claims[SessionIDClaim]); err != nil {
+			return nil, err
+		}
+		sessionID, _ = claims[SessionIDClaim].(string)
+		u, err := a.getUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkActive(logger, u); err != nil {
+			return nil, err
+		}
+		authUser = u
+		return u, nil
+	})
+	if err != nil {
+		logger.WithError(err).Error("Refresh token rejected")
+		return nil, token.Pair{}, err
+	}
+
+	logger = logger.WithField("user-id", authUser.ID())
+	if a.sessions != nil && sessionID != "" {
+		if err := a.sessions.Extend(sessionID); err != nil {
+			//the session still lasts as long as the previous refresh token
+			logger.WithField("session-id", sessionID).WithError(err).Error("Failed to extend session")
+		}
+	}
+
+	logger.Debug("Refreshed token")
+	return authUser, tokens, nil
+}
+
+func (a *defaultService) Logout(ctx context.Context) error {
+	logger := logrus.NewEntry(logrus.StandardLogger())
+	if userID, err := a.token.UserIDFromContext(ctx); err == nil {
+		logger = logger.WithField("user-id", userID)
+	}
+
+	if err := a.token.Revoke(ctx); err != nil {
+		userMessage := "Unable to revoke token"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+	if sessionID, ok := a.token.ClaimFromContext(ctx, SessionIDClaim); ok && a.sessions != nil {
+		if sessionIDStr, isStr := sessionID.(string); isStr {
+			if err := a.sessions.End(sessionIDStr); err != nil {
+				userMessage := "Unable to end session"
+				logger.WithError(err).Error(userMessage)
+				return errors.New(userMessage)
+			}
+		}
+	}
+
+	if a.auditor != nil {
+		userID, _ := a.token.UserIDFromContext(ctx)
+		a.auditor.Record(audit.NewEvent(ctx, audit.ActionLogout, audit.OutcomeSuccess, userID, userID))
+	}
+
+	logger.Debug("Logged out")
+	return nil
+}
+
+func (a *defaultService) RevokeAllTokens(userID string) error {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", userID)
+
+	if err := a.token.RevokeAllForUser(userID); err != nil {
+		userMessage := "Unable to revoke tokens of user"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+	if err := a.revokeAPIKeys(userID); err != nil {
+		userMessage := "Unable to revoke API keys of user"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	logger.Debug("Revoked all tokens of user")
+	return nil
+}
+
+func (a *defaultService) revokeAPIKeys(userID string) error {
+	if a.apiKeys == nil {
+		return nil
+	}
+	return a.apiKeys.RevokeAllForUser(userID)
+}
+
+func (a *defaultService) UnlockUser(userID string) error {
+	if a.lockout == nil {
+		return clienterror.NewError(errors.New("Account lockout is not enabled"), http.StatusBadRequest)
+	}
+	if err := a.lockout.Unlock(userID); err != nil {
+		userMessage := "Unable to unlock user"
+		logrus.WithField("user-id", userID).WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+	return nil
+}
+
+func (a *defaultService) ChangeStatus(userID string, status user.Status) (user.Status, error) {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", userID).WithField("status", status)
+
+	u, err := a.getUser(userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load user")
+		return "", err
+	}
+	previous := u.Status()
+	if err := previous.CheckTransition(status); err != nil {
+		return previous, err
+	}
+
+	if err := a.userRepoFactory.Repo().SetStatus(userID, status); err != nil {
+		userMessage := "Failed to save account status"
+		logger.WithError(err).Error(userMessage)
+		return previous, errors.New(userMessage)
+	}
+	if status != user.StatusActive {
+		if err := a.token.RevokeAllForUser(userID); err != nil {
+			userMessage := "Unable to revoke tokens of user"
+			logger.WithError(err).Error(userMessage)
+			return previous, errors.New(userMessage)
+		}
+	}
+
+	logger.WithField("previous-status", previous).Debug("Changed account status")
+	return previous, nil
+}
+
+func (a *defaultService) checkLockout(ctx context.Context, logger *logrus.Entry, userID string) error {
+	if a.lockout == nil {
+		return nil
+	}
+	if err := a.lockout.Check(userID, request.ClientInfoFromContext(ctx).IP); err != nil {
+		logger.WithError(err).Warn("Login attempt blocked by lockout")
+		return err
+	}
+	return nil
+}
+
+func (a *defaultService) recordFailure(ctx context.Context, logger *logrus.Entry, userID string) {
+	if a.lockout == nil {
+		return
+	}
+	if err := a.lockout.RecordFailure(userID, request.ClientInfoFromContext(ctx).IP); err != nil {
+		logger.WithError(err).Error("Unable to record failed login attempt")
+	}
+}
+
+func (a *defaultService) recordSuccess(ctx context.Context, logger *logrus.Entry, userID string) {
+	if a.lockout == nil {
+		return
+	}
+	if err := a.lockout.RecordSuccess(userID, request.ClientInfoFromContext(ctx).IP); err != nil {
+		logger.WithError(err).Error("Unable to reset failed login attempts")
+	}
+}
+
+//auditResult records the outcome of a login-like action, logins that still need MFA are successful with an
+//"mfa" detail of "required"
+func (a *defaultService) auditResult(ctx context.Context, action audit.Action, userID string, err error) {
+	if a.auditor == nil {
+		return
+	}
+
+	event := audit.NewEvent(ctx, action, audit.OutcomeSuccess, userID, userID)
+	if _, isMFARequired := a.IsMFARequiredErr(err); isMFARequired {
+		event = event.WithDetail("mfa", "required")
+	} else if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event = event.WithReason(err.Error())
+	}
+	a.auditor.Record(event)
+}
+
+func (a *defaultService) ValidatePassword(password string, u user.User) error {
+	if a.passwordPolicy == nil {
+		return nil
+	}
+	return a.passwordPolicy.Validate(password, u)
+}
+
+//checkSession allows tokens without a session, those were issued before sessions were enabled
+func (a *defaultService) checkSession(ctx context.Context, userID string, sessionID interface{}) error {
+	if a.sessions == nil || sessionID == nil {
+		return nil
+	}
+	sessionIDStr, isStr := sessionID.(string)
+	if !isStr {
+		return clienterror.NewError(errors.New("Invalid session"), http.StatusUnauthorized)
+	}
+	return a.sessions.Check(ctx, sessionIDStr, userID)
+}
+
+//activatePending makes accounts that were pending verification active, other statuses are left as is
+func (a *defaultService) activatePending(logger *logrus.Entry, userID string) error {
+	u, err := a.getUser(userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load user")
+		return err
+	}
+	if u.Status() != user.StatusPendingVerification {
+		return nil
+	}
+	if err := a.userRepoFactory.Repo().SetStatus(userID, user.StatusActive); err != nil {
+		userMessage := "Failed to activate account"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+	return nil
+}
+
+func checkActive(logger *logrus.Entry, user user.User) error {
+	if err := user.Status().CheckActive(); err != nil {
+		logger.WithField("user-id", user.ID()).WithField("status", user.Status()).WithError(err).Warn("Inactive account denied")
+		return err
+	}
+	return nil
+}
+
+func (a *defaultService) getUser(userID string) (User, error) {
+	u, err := a.userRepoFactory.Repo().Get(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get user")
+	}
+	authUser, ok := u.(User)
+	if !ok {
+		return nil, errors.Errorf("User type %T does not implement auth.User", u)
+	}
+	return authUser, nil
+}
+
+func (a *defaultService) ForgotPassword(user User) error {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+
+	//only the latest reset token should be usable
+	if err := a.userTokens.RevokeAll(usertoken.PurposePasswordReset, user.ID()); err != nil {
+		userMessage := "Unable to revoke previous password reset tokens"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	resetToken, err := a.userTokens.Issue(usertoken.PurposePasswordReset, user.ID(), a.passwordResetTTL)
+	if err != nil {
+		userMessage := "Unable to generate password reset token"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	if err := a.notifier.PasswordReset(user, resetToken); err != nil {
+		userMessage := "Unable to send password reset token"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	logger.Debug("Sent password reset token")
+	return nil
+}
+
+func (a *defaultService) ResetPassword(resetToken, newPassword string) error {
+	logger := logrus.NewEntry(logrus.StandardLogger())
+
+	//checked before the token is consumed so that a weak password does not burn the token, only the user attribute
+	//rules remain for after
+	if err := a.ValidatePassword(newPassword, nil); err != nil {
+		return err
+	}
+
+	storedToken, err := a.userTokens.Consume(usertoken.PurposePasswordReset, resetToken)
+	if err != nil {
+		logger.WithError(err).Error("Password reset token rejected")
+		return err
+	}
+	logger = logger.WithField("user-id", storedToken.UserID)
+
+	if a.passwordPolicy != nil {
+		u, err := a.getUser(storedToken.UserID)
+		if err != nil {
+			logger.WithError(err).Error("Failed to load user")
+			return err
+		}
+		if err := a.ValidatePassword(newPassword, u); err != nil {
+			return err
+		}
+	}
+
+	passwordHash, err := a.encryption.HashPassword(newPassword)
+	if err != nil {
+		userMessage := "Unable to hash new password"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	if err := a.userRepoFactory.Repo().SetPasswordHash(storedToken.UserID, passwordHash); err != nil {
+		userMessage := "Failed to save new password"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	if err := a.userTokens.RevokeAll(usertoken.PurposePasswordReset, storedToken.UserID); err != nil {
+		logger.WithError(err).Error("Unable to revoke remaining password reset tokens")
+	}
+	if err := a.token.RevokeAllForUser(storedToken.UserID); err != nil {
+		logger.WithError(err).Error("Unable to revoke tokens")
+	}
+	if err := a.revokeAPIKeys(storedToken.UserID); err != nil {
+		logger.WithError(err).Error("Unable to revoke API keys")
+	}
+
+	if a.auditor != nil {
+		//no request context here, so the event has no client info
+		event := audit.NewEvent(context.Background(), audit.ActionPasswordReset, audit.OutcomeSuccess, storedToken.UserID, storedToken.UserID)
+		a.auditor.Record(event)
+	}
+
+	logger.Debug("Password was reset")
+	return nil
+}
+
+func (a *defaultService) ConfirmPassword(ctx context.Context, user User, password string) error {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+
+	//the admin would take over the account with the credentials of the user
+	if a.isImpersonating(ctx) {
+		return clienterror.NewError(errors.New("Cannot use the password of the user while impersonating"), http.StatusForbidden)
+	}
+	if err := a.checkLockout(ctx, logger, user.ID()); err != nil {
+		return err
+	}
+	if err := a.encryption.VerifyPassword(password, user.PasswordHash()); err != nil {
+		logger.WithError(err).Error("User password mismatch")
+		a.recordFailure(ctx, logger, user.ID())
+		return clienterror.NewError(errors.New("Current password is incorrect"), http.StatusForbidden)
+	}
+	a.recordSuccess(ctx, logger, user.ID())
+	return nil
+}
+
+func (a *defaultService) ChangePassword(ctx context.Context, user User, currentPassword, newPassword string) (err error) {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+	defer func() { a.auditResult(ctx, audit.ActionPasswordChange, user.ID(), err) }()
+
+	if err := a.ConfirmPassword(ctx, user, currentPassword); err != nil {
+		return err
+	}
+	if err := a.ValidatePassword(newPassword, user); err != nil {
+		return err
+	}
+
+	passwordHash, err := a.encryption.HashPassword(newPassword)
+	if err != nil {
+		userMessage := "Unable to hash new password"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+	if err := a.userRepoFactory.Repo().SetPasswordHash(user.ID(), passwordHash); err != nil {
+		userMessage := "Failed to save new password"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	if err := a.userTokens.RevokeAll(usertoken.PurposePasswordReset, user.ID()); err != nil {
+		logger.WithError(err).Error("Unable to revoke password reset tokens")
+	}
+	if err := a.token.RevokeAllForUser(user.ID()); err != nil {
+		logger.WithError(err).Error("Unable to revoke tokens")
+	}
+	if err := a.revokeAPIKeys(user.ID()); err != nil {
+		logger.WithError(err).Error("Unable to revoke API keys")
+	}
+
+	logger.Debug("Password was changed")
+	return nil
+}
+
+func (a *defaultService) ChangeEmail(ctx context.Context, user User, currentPassword string, updatedUser User) (User, bool, error) {
+	if err := a.ConfirmPassword(ctx, user, currentPassword); err != nil {
+		return nil, false, err
+	}
+	return a.SetEmail(user, updatedUser)
+}
+
+func (a *defaultService) SetEmail(user User, updatedUser User) (User, bool, error) {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+
+	if updatedUser.ID() != user.ID() {
+		return nil, false, clienterror.NewError(errors.New("The user ID cannot be changed"), http.StatusBadRequest)
+	}
+	email, isEmailUser := userEmail(user)
+	updatedEmail, isUpdatedEmailUser := userEmail(updatedUser)
+	if !isEmailUser || !isUpdatedEmailUser {
+		return nil, false, errors.New("User does not implement auth.EmailUser")
+	}
+	if strings.EqualFold(strings.TrimSpace(updatedEmail), strings.TrimSpace(email)) {
+		return nil, false, clienterror.NewError(errors.New("The new email is the same as the current one"), http.StatusBadRequest)
+	}
+
+	userRepo := a.userRepoFactory.Repo()
+	if err := userRepo.Update(updatedUser); err != nil {
+		if userRepo.IsDupErr(err) {
+			return nil, false, clienterror.NewError(errors.New("Email is already in use"), http.StatusConflict)
+		}
+		userMessage := "Failed to save new email"
+		logger.WithError(err).Error(userMessage)
+		return nil, false, errors.New(userMessage)
+	}
+	//not left to updatedUser, the new address is unverified no matter how the app builds the user
+	if err := userRepo.SetEmailUnverified(user.ID()); err != nil {
+		userMessage := "Failed to mark new email as not verified"
+		logger.WithError(err).Error(userMessage)
+		return nil, false, errors.New(userMessage)
+	}
+	for _, purpose := range []usertoken.Purpose{usertoken.PurposePasswordReset, usertoken.PurposeMagicLogin} {
+		if err := a.userTokens.RevokeAll(purpose, user.ID()); err != nil {
+			userMessage := "Unable to revoke tokens sent to the previous email"
+			logger.WithError(err).WithField("purpose", purpose).Error(userMessage)
+			return nil, false, errors.New(userMessage)
+		}
+	}
+
+	changedUser, err := a.getUser(user.ID())
+	if err != nil {
+		logger.WithError(err).Error("Failed to load user")
+		return nil, false, err
+	}
+	if !a.requireEmailVerification {
+		logger.Debug("Email was changed")
+		return changedUser, false, nil
+	}
+	if err := a.SendEmailVerification(changedUser); err != nil {
+		return changedUser, false, err
+	}
+	logger.Debug("Email was changed, verification sent")
+	return changedUser, true, nil
+}
+
+func (a *defaultService) EmailVerificationRequired() bool { return a.requireEmailVerification }
+
+func (a *defaultService) SendEmailVerification(user User) error {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", user.ID())
+
+	claims := map[string]interface{}{emailHashClaim: a.emailHash(user)}
+	verificationToken, err := a.token.CreateSignedWithClaims(emailVerificationPurpose, user.ID(), claims, a.emailVerificationTTL)
+	if err != nil {
+		userMessage := "Unable to generate email verification token"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	if err := a.notifier.VerifyEmail(user, verificationToken); err != nil {
+		userMessage := "Unable to send email verification token"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+
+	logger.Debug("Sent email verification token")
+	return nil
+}
+
+//emailHash keeps the address itself out of the token, it is empty for users that are not an EmailUser
+func (a *defaultService) emailHash(user User) string {
+	email, isEmailUser := userEmail(user)
+	if !isEmailUser {
+		return ""
+	}
+	return a.encryption.HashToken(strings.ToLower(strings.TrimSpace(email)))
+}
+
+func (a *defaultService) VerifyEmail(verificationToken string) error {
+	logger := logrus.NewEntry(logrus.StandardLogger())
+
+	userID, claims, err := a.token.ParseSignedWithClaims(emailVerificationPurpose, verificationToken)
+	if err != nil {
+		userMessage := "Invalid or expired email verification token"
+		logger.WithError(err).Error(userMessage)
+		return clienterror.NewError(errors.New(userMessage), http.StatusBadRequest)
+	}
+	logger = logger.WithField("user-id", userID)
+
+	//the email may have changed since the token was sent
+	u, err := a.getUser(userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load user")
+		return err
+	}
+	tokenEmailHash, _ := claims[emailHashClaim].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenEmailHash), []byte(a.emailHash(u))) != 1 {
+		userMessage := "Email verification token is not for the current email address"
+		logger.Error(userMessage)
+		return clienterror.NewError(errors.New(userMessage), http.StatusBadRequest)
+	}
+
+	userRepo := a.userRepoFactory.Repo()
+	if err := userRepo.SetEmailVerified(userID); err != nil {
+		userMessage := "Failed to mark email as verified"
+		logger.WithError(err).Error(userMessage)
+		return errors.New(userMessage)
+	}
+	if err := a.activatePending(logger, userID); err != nil {
+		return err
+	}
+
+	logger.Debug("Verified email")
+	return nil
 }
@@ -0,0 +1,17 @@
+package auth
+
+import "context"
+
+//Sessions keeps a server-side record of every login, the session ID is carried in the SessionIDClaim of the tokens
+type Sessions interface {
+	//Start records a new session for the client in ctx (see request.ClientContext)
+	Start(ctx context.Context, userID string) (sessionID string, err error)
+	//Check fails if the session was revoked or does not belong to the user, it also updates the last seen time
+	Check(ctx context.Context, sessionID, userID string) error
+	//Extend keeps the session active as long as the refresh token that was just rotated
+	Extend(sessionID string) error
+	End(sessionID string) error
+}
+
+//SessionIDClaim is the access token claim holding the session ID, see Middleware.GetContextSessionID
+const SessionIDClaim = "sid"
@@ -9,5 +9,25 @@ type User interface {
 	user.User
 
 	PasswordHash() string
+	//Deprecated: MagicLoginToken is no longer used, magic login tokens are issued and consumed by the usertoken
+	//service. It is kept so existing callers still compile.
 	MagicLoginToken() *string
 }
+
+//EmailUser is optionally implemented by a User, it is checked with a type assertion. Email is the address the
+//Notifier delivers to. Without it email verification tokens are not bound to the address they were sent to and the
+//email cannot be changed with Service.ChangeEmail or Service.SetEmail.
+type EmailUser interface {
+	User
+
+	Email() string
+}
+
+//userEmail returns the email of an EmailUser, isEmailUser is false for other users
+func userEmail(user User) (email string, isEmailUser bool) {
+	emailUser, isEmailUser := user.(EmailUser)
+	if !isEmailUser {
+		return "", false
+	}
+	return emailUser.Email(), true
+}
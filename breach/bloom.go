@@ -0,0 +1,158 @@
+package breach
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+//bloomMagic starts every bloom index file, followed by the version
+const (
+	bloomMagic   = "GBLOOM"
+	bloomVersion = uint16(1)
+)
+
+//Bloom is a bloom filter over SHA-1 hashes, since the hashes are already uniform the bit positions are derived from
+//the hash bytes (double hashing) instead of hashing again
+type Bloom struct {
+	bits     []uint64
+	m        uint64
+	k        uint32
+	minCount uint32
+}
+
+//NewBloom sizes the filter for n hashes with the false positive rate, minCount is the breach count the hashes were
+//filtered on and what BloomChecker reports for a match
+func NewBloom(n uint64, falsePositiveRate float64, minCount uint32) *Bloom {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &Bloom{
+		bits:     make([]uint64, m/64),
+		m:        m,
+		k:        k,
+		minCount: minCount,
+	}
+}
+
+//AddHash adds a hex SHA-1 hash
+func (b *Bloom) AddHash(hexHash string) error {
+	h1, h2, err := splitHash(hexHash)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+	return nil
+}
+
+//TestHash reports whether the hex SHA-1 hash was probably added
+func (b *Bloom) TestHash(hexHash string) (bool, error) {
+	h1, h2, err := splitHash(hexHash)
+	if err != nil {
+		return false, err
+	}
+	for i := uint32(0); i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func splitHash(hexHash string) (uint64, uint64, error) {
+	raw, err := hex.DecodeString(hexHash)
+	if err != nil || len(raw) < 16 {
+		return 0, 0, errors.Errorf("Invalid SHA-1 hash '%s'", hexHash)
+	}
+	h1 := binary.BigEndian.Uint64(raw[0:8])
+	h2 := binary.BigEndian.Uint64(raw[8:16]) | 1 //odd, so that the k positions differ
+	return h1, h2, nil
+}
+
+//WriteTo writes the index file
+func (b *Bloom) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	written := int64(0)
+	for _, v := range []interface{}{[]byte(bloomMagic), bloomVersion, b.m, b.k, b.minCount} {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return written, errors.Wrapf(err, "Failed to write bloom header")
+		}
+		written += int64(binary.Size(v))
+	}
+	if err := binary.Write(bw, binary.LittleEndian, b.bits); err != nil {
+		return written, errors.Wrapf(err, "Failed to write bloom bits")
+	}
+	written += int64(len(b.bits) * 8)
+	return written, bw.Flush()
+}
+
+//ReadBloom reads an index file written by WriteTo
+func ReadBloom(r io.Reader) (*Bloom, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(bloomMagic))
+	var version uint16
+	b := &Bloom{}
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != bloomMagic {
+		return nil, errors.New("Not a bloom index file")
+	}
+	for _, v := range []interface{}{&version, &b.m, &b.k, &b.minCount} {
+		if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+			return nil, errors.Wrapf(err, "Failed to read bloom header")
+		}
+	}
+	if version != bloomVersion {
+		return nil, errors.Errorf("Unsupported bloom index version %d", version)
+	}
+	if b.m == 0 || b.m%64 != 0 || b.k == 0 {
+		return nil, errors.New("Invalid bloom index header")
+	}
+
+	b.bits = make([]uint64, b.m/64)
+	if err := binary.Read(br, binary.LittleEndian, b.bits); err != nil {
+		return nil, errors.Wrapf(err, "Failed to read bloom bits")
+	}
+	return b, nil
+}
+
+//BloomChecker loads a bloom index (see cmd/breachindex) into memory. A bloom filter has no counts, a match is
+//reported as the minimum count the index was built with, and a small fraction of matches are false positives.
+func BloomChecker(path string) (*bloomChecker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open bloom index")
+	}
+	defer f.Close()
+
+	bloom, err := ReadBloom(f)
+	if err != nil {
+		return nil, err
+	}
+	return &bloomChecker{bloom}, nil
+}
+
+type bloomChecker struct {
+	bloom *Bloom
+}
+
+func (c *bloomChecker) Count(password string) (int, error) {
+	found, err := c.bloom.TestHash(HashPassword(password))
+	if err != nil || !found {
+		return 0, err
+	}
+	if c.bloom.minCount == 0 {
+		return 1, nil
+	}
+	return int(c.bloom.minCount), nil
+}
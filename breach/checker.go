@@ -0,0 +1,36 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Checker tells how often a password was seen in breach corpora, it implements passwordpolicy.BreachChecker
+type Checker interface {
+	Count(password string) (int, error)
+}
+
+//HashPassword returns the uppercase hex SHA-1 of the password, as used in the HIBP dumps
+func HashPassword(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+//ParseDumpLine parses a "<hash>:<count>" line of a dump, lines without a count are counted once
+func ParseDumpLine(line string) (hash string, count int, err error) {
+	line = strings.TrimSpace(line)
+	parts := strings.SplitN(line, ":", 2)
+	hash = strings.ToUpper(parts[0])
+	if len(parts) == 1 {
+		return hash, 1, nil
+	}
+	count, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "Invalid count in line '%s'", line)
+	}
+	return hash, count, nil
+}
@@ -0,0 +1,141 @@
+package breach
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//SortedFileChecker binary searches a dump with "<SHA-1>:<count>" lines ordered by hash (the HIBP "ordered by hash"
+//download) without loading it into memory
+func SortedFileChecker(path string) (*sortedFileChecker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open breach dump")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Failed to stat breach dump")
+	}
+	return &sortedFileChecker{file: f, size: info.Size()}, nil
+}
+
+type sortedFileChecker struct {
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+func (c *sortedFileChecker) Close() error { return c.file.Close() }
+
+func (c *sortedFileChecker) Count(password string) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	hash := HashPassword(password)
+	//the line holding hash (if any) starts in [lo, hi), lo is always the start of a line
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		lineStart, nextLineStart, line, err := c.lineAfter(mid, lo)
+		if err != nil {
+			return 0, err
+		}
+		if lineStart >= hi || line == "" {
+			hi = mid
+			continue
+		}
+
+		lineHash, count, err := ParseDumpLine(line)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case lineHash == hash:
+			return count, nil
+		case lineHash < hash:
+			lo = nextLineStart
+		default:
+			hi = lineStart
+		}
+	}
+	return 0, nil
+}
+
+//lineAfter returns the first line that starts at or after offset and where the line after it starts, offset ==
+//knownLineStart means offset is the start of a line
+func (c *sortedFileChecker) lineAfter(offset, knownLineStart int64) (int64, int64, string, error) {
+	//starting one byte early finds a line that starts exactly at offset
+	if offset != knownLineStart {
+		offset--
+	}
+	if _, err := c.file.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, "", errors.Wrapf(err, "Failed to seek breach dump")
+	}
+	reader := bufio.NewReader(c.file)
+	if offset != knownLineStart {
+		//skip the rest of the line we landed in
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return c.size, c.size, "", nil
+		}
+		if err != nil {
+			return 0, 0, "", errors.Wrapf(err, "Failed to read breach dump")
+		}
+		offset += int64(len(skipped))
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, 0, "", errors.Wrapf(err, "Failed to read breach dump")
+	}
+	return offset, offset + int64(len(line)), strings.TrimRight(line, "\r\n"), nil
+}
+
+//RangeDirChecker reads a directory of HIBP range files, one per 5 character hash prefix (like "21BD1" or
+//"21BD1.txt") with "<35 character suffix>:<count>" lines, as downloaded from the range API
+func RangeDirChecker(dir string) *rangeDirChecker {
+	return &rangeDirChecker{dir}
+}
+
+type rangeDirChecker struct {
+	dir string
+}
+
+func (c *rangeDirChecker) Count(password string) (int, error) {
+	hash := HashPassword(password)
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(c.dir, prefix))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(c.dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to open breach range file")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, err := ParseDumpLine(scanner.Text())
+		if err != nil {
+			return 0, err
+		}
+		if lineSuffix == suffix {
+			return count, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, errors.Wrapf(err, "Failed to read breach range file")
+	}
+	return 0, nil
+}
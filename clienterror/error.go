@@ -21,6 +21,22 @@ func NewErrorDefaultStatus(err error) Error {
 	return NewError(err, 500)
 }
 
+//DetailedError also carries structured Details (like validation violations) for the client
+type DetailedError interface {
+	Error
+	Details() interface{}
+}
+
+func NewErrorWithDetails(err error, status int, details interface{}) DetailedError {
+	return &detailedError{
+		localError: localError{
+			Err:    errors.WithStack(err),
+			status: status,
+		},
+		details: details,
+	}
+}
+
 type localError struct {
 	Err    error
 	status int
@@ -28,3 +44,10 @@ type localError struct {
 
 func (e *localError) Error() string { return e.Err.Error() }
 func (e *localError) Status() int   { return e.status }
+
+type detailedError struct {
+	localError
+	details interface{}
+}
+
+func (e *detailedError) Details() interface{} { return e.details }
@@ -0,0 +1,103 @@
+//Command breachindex builds a compact bloom index (see breach.BloomChecker) from a HIBP-style SHA-1 dump with
+//"<hash>:<count>" lines:
+//
+//	breachindex -in pwned-passwords-sha1-ordered-by-hash.txt -out breached.bloom -min-count 10 -fp-rate 0.001
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/breach"
+)
+
+func main() {
+	in := flag.String("in", "", "HIBP-style SHA-1 dump with <hash>:<count> lines (required)")
+	out := flag.String("out", "", "Path of the bloom index to write (required)")
+	minCount := flag.Int("min-count", 1, "Only index hashes seen at least this many times")
+	fpRate := flag.Float64("fp-rate", 0.001, "False positive rate of the bloom filter")
+	flag.Parse()
+
+	if *in == "" || *out == "" || *minCount < 1 || *fpRate <= 0 || *fpRate >= 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := build(*in, *out, uint32(*minCount), *fpRate); err != nil {
+		logrus.WithError(err).Fatal("Failed to build breach index")
+	}
+}
+
+func build(in, out string, minCount uint32, fpRate float64) error {
+	//the first pass counts the hashes to size the filter
+	n := uint64(0)
+	if err := eachHash(in, minCount, func(hash string) error {
+		n++
+		return nil
+	}); err != nil {
+		return err
+	}
+	logrus.Infof("Indexing %d hashes seen at least %d times", n, minCount)
+
+	bloom := breach.NewBloom(n, fpRate, minCount)
+	if err := eachHash(in, minCount, bloom.AddHash); err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create %s", out)
+	}
+	size, err := bloom.WriteTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to close %s", out)
+	}
+
+	logrus.Infof("Wrote %s (%s)", out, humanSize(size))
+	return nil
+}
+
+func eachHash(path string, minCount uint32, fn func(hash string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open %s", path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		hash, count, err := breach.ParseDumpLine(scanner.Text())
+		if err != nil {
+			return errors.Wrapf(err, "Line %d", lineNumber)
+		}
+		if hash == "" || count < int(minCount) {
+			continue
+		}
+		if err := fn(hash); err != nil {
+			return errors.Wrapf(err, "Line %d", lineNumber)
+		}
+	}
+	return errors.Wrapf(scanner.Err(), "Failed to read %s", path)
+}
+
+func humanSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,192 @@
+//Command userbulk imports and exports users through the admin API (see admin.Router), the format follows from the
+//file extension (.csv or .jsonl):
+//
+//	userbulk -url https://api.example.com/admin -token $ADMIN_TOKEN import -in users.csv -dry-run
+//	userbulk -url https://api.example.com/admin -token $ADMIN_TOKEN export -out users.jsonl -query 'filter[status]=active'
+//
+//Rows without a password are invited. The import result with the per-row errors is printed to stdout.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/admin"
+)
+
+func main() {
+	baseURL := flag.String("url", "", "Base URL of the admin API, like https://api.example.com/admin (required)")
+	token := flag.String("token", os.Getenv("ADMIN_TOKEN"), "Access token of an admin, defaults to $ADMIN_TOKEN")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *baseURL == "" || *token == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	client := &apiClient{baseURL: strings.TrimSuffix(*baseURL, "/"), token: *token}
+
+	var err error
+	switch command, args := flag.Arg(0), flag.Args()[1:]; command {
+	case "import":
+		err = runImport(client, args)
+	case "export":
+		err = runExport(client, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed")
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s -url <admin api url> [-token <token>] import|export [flags]\n\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func runImport(client *apiClient, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	in := flags.String("in", "", "CSV or JSON lines file with a user per row (required)")
+	format := flags.String("format", "", "csv or jsonl, defaults to the extension of -in")
+	dryRun := flags.Bool("dry-run", false, "Only validate the rows, no users are added")
+	flags.Parse(args)
+
+	if *in == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	bulkFormat, err := formatOf(*format, *in)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open %s", *in)
+	}
+	defer f.Close()
+
+	query := url.Values{"format": {string(bulkFormat)}, "dry_run": {strconv.FormatBool(*dryRun)}}
+	contentType := "application/x-ndjson"
+	if bulkFormat == admin.FormatCSV {
+		contentType = "text/csv"
+	}
+	resp, err := client.do("POST", "/users/import", query, f, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read import result")
+	}
+	indented := &bytes.Buffer{}
+	if json.Indent(indented, body, "", "  ") == nil {
+		body = indented.Bytes()
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+func runExport(client *apiClient, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "", "File to write, the users are written to stdout (as JSON lines by default) if empty")
+	format := flags.String("format", "", "csv or jsonl, defaults to the extension of -out")
+	rawQuery := flags.String("query", "", "Filters, search and sort of the user list, like 'filter[status]=active&sort=email'")
+	flags.Parse(args)
+
+	bulkFormat, err := formatOf(*format, *out)
+	if err != nil {
+		return err
+	}
+	query, err := url.ParseQuery(*rawQuery)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid -query")
+	}
+	query.Set("format", string(bulkFormat))
+
+	resp, err := client.do("GET", "/users/export", query, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create %s", *out)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write export")
+	}
+	if *out != "" {
+		logrus.Infof("Wrote %s (%d bytes)", *out, n)
+	}
+	return nil
+}
+
+//formatOf is format if set, otherwise it follows from the extension of path
+func formatOf(format, path string) (admin.BulkFormat, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "" || format == "json" || format == "ndjson" {
+			format = string(admin.FormatJSONLines)
+		}
+	}
+
+	switch bulkFormat := admin.BulkFormat(format); bulkFormat {
+	case admin.FormatCSV, admin.FormatJSONLines:
+		return bulkFormat, nil
+	}
+	return "", errors.Errorf("Unknown format '%s', use csv or jsonl", format)
+}
+
+type apiClient struct {
+	baseURL string
+	token   string
+}
+
+//do fails for non-2xx responses, with the response body in the error
+func (c *apiClient) do(method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+path+"?"+query.Encode(), body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s failed", method, path)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, errors.Errorf("%s %s failed with status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
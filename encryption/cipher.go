@@ -0,0 +1,63 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+//Cipher encrypts secrets that need to be read back later (unlike passwords, which are hashed)
+type Cipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+//AESCipher uses AES-GCM, the key must be 16, 24 or 32 bytes long
+func AESCipher(key []byte) *aesCipher {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		logrus.Panicf("Invalid AES cipher key, error: %s", err.Error())
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		logrus.Panicf("Unable to create AES-GCM cipher, error: %s", err.Error())
+	}
+	return &aesCipher{gcm}
+}
+
+type aesCipher struct {
+	gcm cipher.AEAD
+}
+
+func (c *aesCipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrapf(err, "Unable to generate nonce")
+	}
+
+	sealed := c.gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (c *aesCipher) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to decode ciphertext")
+	}
+
+	nonceSize := c.gcm.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("Ciphertext is too short")
+	}
+
+	plaintext, err := c.gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to decrypt ciphertext")
+	}
+	return string(plaintext), nil
+}
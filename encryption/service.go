@@ -2,6 +2,8 @@ package encryption
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 
 	"github.com/pkg/errors"
@@ -13,6 +15,10 @@ type Service interface {
 	NewRandomPassword() (string, error)
 	HashPassword(password string) (string, error)
 	VerifyPassword(password, hashedPassword string) error
+
+	NewSecureToken(byteLength int) (string, error)
+	HashToken(token string) string
+	VerifyTokenHash(token, tokenHash string) bool
 }
 
 func DefaultService() *defaultService { return &defaultService{} }
@@ -41,6 +47,24 @@ func (*defaultService) VerifyPassword(password, hashedPassword string) error {
 	return nil
 }
 
+func (d *defaultService) NewSecureToken(byteLength int) (string, error) {
+	token, err := d.generateMagicToken(byteLength)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to generate secure token")
+	}
+	return token, nil
+}
+
+//HashToken uses a fast hash since tokens are already high-entropy random values (unlike passwords)
+func (*defaultService) HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (d *defaultService) VerifyTokenHash(token, tokenHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(d.HashToken(token)), []byte(tokenHash)) == 1
+}
+
 func (*defaultService) generateSecureRandomBytes(n int) ([]byte, error) {
 	b := make([]byte, n)
 	_, err := rand.Read(b)
@@ -0,0 +1,62 @@
+package lockout
+
+import "time"
+
+//Policy decides how long a key (user or IP) is blocked after failed attempts. Every failure blocks the key for
+//BaseDelay doubled per previous failure (capped at MaxDelay), after MaxFailures the key is locked for LockDuration.
+type Policy struct {
+	MaxFailures  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockDuration time.Duration
+	//Window is how long failures are remembered, a key without failures within the window starts over
+	Window time.Duration
+}
+
+func DefaultUserPolicy() Policy {
+	return Policy{
+		MaxFailures:  5,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockDuration: 15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+}
+
+//DefaultIPPolicy allows more failures than DefaultUserPolicy since many users can share an IP
+func DefaultIPPolicy() Policy {
+	return Policy{
+		MaxFailures:  50,
+		BaseDelay:    0,
+		MaxDelay:     0,
+		LockDuration: 15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+}
+
+//block decides on the failure count returned by Store.RecordFailure
+func (p Policy) block(failures int, now time.Time) (locked bool, blockedUntil time.Time) {
+	if p.MaxFailures > 0 && failures >= p.MaxFailures {
+		return true, now.Add(p.LockDuration)
+	}
+	return false, now.Add(p.delay(failures))
+}
+
+//startsOver is true when the last failure is outside the window and the key is no longer blocked
+func (p Policy) startsOver(state State, now time.Time) bool {
+	return now.Sub(state.LastFailureAt) > p.Window && !now.Before(state.BlockedUntil)
+}
+
+func (p Policy) delay(failures int) time.Duration {
+	if p.BaseDelay <= 0 || failures <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,113 @@
+package lockout
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/clienterror"
+)
+
+//Service throttles failed attempts (like password logins) per user and per IP
+type Service interface {
+	//Check returns a clienterror.Error if the user or IP is currently blocked
+	Check(userID, ip string) error
+	RecordFailure(userID, ip string) error
+	RecordSuccess(userID, ip string) error
+	Unlock(userID string) error
+}
+
+func DefaultService(userPolicy, ipPolicy Policy, store Store) *defaultService {
+	return &defaultService{
+		userPolicy,
+		ipPolicy,
+		store,
+	}
+}
+
+type defaultService struct {
+	userPolicy Policy
+	ipPolicy   Policy
+	store      Store
+}
+
+func userKey(userID string) string { return "user:" + userID }
+func ipKey(ip string) string       { return "ip:" + ip }
+
+func (s *defaultService) Check(userID, ip string) error {
+	for _, key := range s.keys(userID, ip) {
+		state, err := s.store.Get(key)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get lockout state")
+		}
+
+		now := time.Now()
+		if !now.Before(state.BlockedUntil) {
+			continue
+		}
+
+		retryIn := state.BlockedUntil.Sub(now).Round(time.Second)
+		if state.Locked {
+			return clienterror.NewError(errors.Errorf("Too many failed attempts, locked for %s", retryIn), http.StatusLocked)
+		}
+		return clienterror.NewError(errors.Errorf("Too many failed attempts, try again in %s", retryIn), http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+func (s *defaultService) RecordFailure(userID, ip string) error {
+	if userID != "" {
+		if err := s.recordFailure(userKey(userID), s.userPolicy); err != nil {
+			return err
+		}
+	}
+	if ip != "" {
+		if err := s.recordFailure(ipKey(ip), s.ipPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//RecordSuccess only resets the user, resetting the IP would let an attacker with one valid account try others
+func (s *defaultService) RecordSuccess(userID, ip string) error {
+	if userID == "" {
+		return nil
+	}
+	if err := s.store.Delete(userKey(userID)); err != nil {
+		return errors.Wrapf(err, "Failed to reset lockout state")
+	}
+	return nil
+}
+
+func (s *defaultService) Unlock(userID string) error {
+	if err := s.store.Delete(userKey(userID)); err != nil {
+		return errors.Wrapf(err, "Failed to unlock user")
+	}
+	logrus.WithField("user-id", userID).Info("Unlocked user")
+	return nil
+}
+
+func (s *defaultService) keys(userID, ip string) []string {
+	keys := []string{}
+	if userID != "" {
+		keys = append(keys, userKey(userID))
+	}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+func (s *defaultService) recordFailure(key string, policy Policy) error {
+	state, err := s.store.RecordFailure(key, policy)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to record failed attempt")
+	}
+	if state.Locked && state.Failures == policy.MaxFailures {
+		logrus.WithField("lockout-key", key).Warnf("Locked after %d failed attempts", state.Failures)
+	}
+	return nil
+}
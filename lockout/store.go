@@ -0,0 +1,166 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/francoishill/gomponents/mongo"
+)
+
+//State is the failure count of a key, like "user:<id>" or "ip:<address>"
+type State struct {
+	Key           string    `bson:"_id" json:"key"`
+	Failures      int       `bson:"failures" json:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at" json:"last_failure_at"`
+	BlockedUntil  time.Time `bson:"blocked_until" json:"blocked_until"`
+	Locked        bool      `bson:"locked" json:"locked"`
+	//ExpiresAt is when the state can be forgotten
+	ExpiresAt time.Time `bson:"expires_at" json:"-"`
+}
+
+//Store persists lock state, use a shared store (like MongoStore) when running multiple instances
+type Store interface {
+	//Get returns a zero State (with Key set) if there is none
+	Get(key string) (State, error)
+	//RecordFailure atomically counts a failure of key and blocks it by policy (see Policy.block), it returns the new
+	//state. Concurrent failures must each be counted.
+	RecordFailure(key string, policy Policy) (State, error)
+	Delete(key string) error
+}
+
+//MemoryStore is only suitable for a single instance
+func MemoryStore() *memoryStore {
+	return &memoryStore{states: map[string]State{}}
+}
+
+type memoryStore struct {
+	lock   sync.Mutex
+	states map[string]State
+}
+
+func (s *memoryStore) Get(key string) (State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	state, ok := s.states[key]
+	if !ok || time.Now().After(state.ExpiresAt) {
+		return State{Key: key}, nil
+	}
+	return state, nil
+}
+
+func (s *memoryStore) RecordFailure(key string, policy Policy) (State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for existingKey, existing := range s.states {
+		if now.After(existing.ExpiresAt) {
+			delete(s.states, existingKey)
+		}
+	}
+
+	state, ok := s.states[key]
+	if !ok || policy.startsOver(state, now) {
+		state = State{Key: key}
+	}
+	state.Failures++
+	state.LastFailureAt = now
+	state.Locked, state.BlockedUntil = policy.block(state.Failures, now)
+	state.ExpiresAt = state.BlockedUntil.Add(policy.Window)
+	s.states[key] = state
+	return state, nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.states, key)
+	return nil
+}
+
+//MongoStore removes expired states with a TTL index
+func MongoStore(m mongo.Mongo) *mongoStore {
+	s := &mongoStore{m}
+	indexes := []mgo.Index{{Key: []string{"expires_at"}, ExpireAfter: time.Second}}
+	if err := m.EnsureIndexes(s.collection(), indexes); err != nil {
+		logrus.Panicf("Failed to ensure lockout indexes, error: %s", err.Error())
+	}
+	return s
+}
+
+type mongoStore struct {
+	m mongo.Mongo
+}
+
+func (s *mongoStore) collection() *mgo.Collection { return s.m.Collection("lockouts") }
+
+func (s *mongoStore) Get(key string) (State, error) {
+	var state State
+	if err := s.collection().FindId(key).One(&state); err != nil {
+		if s.m.IsErrNotFound(err) {
+			return State{Key: key}, nil
+		}
+		return State{}, s.m.RefreshIfConnectionError(err)
+	}
+	if time.Now().After(state.ExpiresAt) {
+		return State{Key: key}, nil
+	}
+	return state, nil
+}
+
+//RecordFailure starts over and increments in separate atomic updates, so that concurrent failures are all counted.
+//The block is only ever extended ($max), a slower request with a lower count cannot shorten it.
+func (s *mongoStore) RecordFailure(key string, policy Policy) (State, error) {
+	now := time.Now()
+
+	startOver := bson.M{
+		"_id": key,
+		"$or": []bson.M{
+			{"expires_at": bson.M{"$lt": now}},
+			{"last_failure_at": bson.M{"$lt": now.Add(-policy.Window)}, "blocked_until": bson.M{"$lte": now}},
+		},
+	}
+	reset := bson.M{"$set": bson.M{"failures": 0, "locked": false, "blocked_until": time.Time{}}}
+	if err := s.collection().Update(startOver, reset); err != nil && !s.m.IsErrNotFound(err) {
+		return State{}, s.m.RefreshIfConnectionError(err)
+	}
+
+	var state State
+	change := mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"last_failure_at": now}},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+	if _, err := s.collection().FindId(key).Apply(change, &state); err != nil {
+		return State{}, s.m.RefreshIfConnectionError(err)
+	}
+
+	locked, blockedUntil := policy.block(state.Failures, now)
+	update := bson.M{"$max": bson.M{"blocked_until": blockedUntil, "expires_at": blockedUntil.Add(policy.Window)}}
+	if locked {
+		update["$set"] = bson.M{"locked": true}
+	}
+	if err := s.collection().UpdateId(key, update); err != nil {
+		return State{}, s.m.RefreshIfConnectionError(err)
+	}
+
+	state.Locked = state.Locked || locked
+	if blockedUntil.After(state.BlockedUntil) {
+		state.BlockedUntil = blockedUntil
+		state.ExpiresAt = blockedUntil.Add(policy.Window)
+	}
+	return state, nil
+}
+
+func (s *mongoStore) Delete(key string) error {
+	err := s.collection().RemoveId(key)
+	if s.m.IsErrNotFound(err) {
+		return nil
+	}
+	return s.m.RefreshIfConnectionError(err)
+}
@@ -0,0 +1,194 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Message is a single email, at least one of Text and HTML is required. Addresses may include a display name, like
+//"Jane <jane@example.com>".
+type Message struct {
+	From    string
+	To      []string
+	ReplyTo string
+	Subject string
+	Text    string
+	HTML    string
+	//Headers are added as is, they cannot override the headers set from the other fields
+	Headers map[string]string
+}
+
+//Envelope returns the bare sender and recipient addresses for the SMTP envelope
+func (m Message) Envelope() (from string, to []string, err error) {
+	fromAddress, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return "", nil, permanentErr{errors.Wrapf(err, "Invalid from address '%s'", m.From)}
+	}
+	if len(m.To) == 0 {
+		return "", nil, permanentErr{errors.New("Message has no recipients")}
+	}
+	for _, t := range m.To {
+		toAddress, err := mail.ParseAddress(t)
+		if err != nil {
+			return "", nil, permanentErr{errors.Wrapf(err, "Invalid recipient address '%s'", t)}
+		}
+		to = append(to, toAddress.Address)
+	}
+	return fromAddress.Address, to, nil
+}
+
+//Validate checks the addresses and headers, errors are permanent (see IsPermanentErr)
+func (m Message) Validate() error {
+	if _, _, err := m.Envelope(); err != nil {
+		return err
+	}
+	if m.ReplyTo != "" {
+		if _, err := mail.ParseAddress(m.ReplyTo); err != nil {
+			return permanentErr{errors.Wrapf(err, "Invalid reply-to address '%s'", m.ReplyTo)}
+		}
+	}
+	if m.Text == "" && m.HTML == "" {
+		return permanentErr{errors.New("Message has no body")}
+	}
+	for key, value := range m.Headers {
+		if strings.ContainsAny(key, "\r\n: ") || strings.ContainsAny(value, "\r\n") {
+			return permanentErr{errors.Errorf("Invalid header '%s'", key)}
+		}
+	}
+	return nil
+}
+
+//Bytes encodes the message in RFC 5322 format, with a multipart/alternative body if it has both Text and HTML
+func (m Message) Bytes() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	from, _ := mail.ParseAddress(m.From)
+	to := []string{}
+	for _, t := range m.To {
+		toAddress, _ := mail.ParseAddress(t)
+		to = append(to, toAddress.String())
+	}
+
+	buf := &bytes.Buffer{}
+	writeHeader := func(key, value string) { fmt.Fprintf(buf, "%s: %s\r\n", key, value) }
+
+	writeHeader("From", from.String())
+	writeHeader("To", strings.Join(to, ", "))
+	if m.ReplyTo != "" {
+		replyTo, _ := mail.ParseAddress(m.ReplyTo)
+		writeHeader("Reply-To", replyTo.String())
+	}
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	messageID, err := newMessageID(from.Address)
+	if err != nil {
+		return nil, err
+	}
+	writeHeader("Message-ID", messageID)
+	writeHeader("MIME-Version", "1.0")
+
+	reserved := map[string]bool{}
+	for _, key := range []string{"From", "To", "Reply-To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		reserved[key] = true
+	}
+	keys := []string{}
+	for key := range m.Headers {
+		if !reserved[textproto.CanonicalMIMEHeaderKey(key)] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeHeader(key, m.Headers[key])
+	}
+
+	if m.Text == "" || m.HTML == "" {
+		contentType, body := "text/plain; charset=utf-8", m.Text
+		if m.HTML != "" {
+			contentType, body = "text/html; charset=utf-8", m.HTML
+		}
+		writeHeader("Content-Type", contentType)
+		writeHeader("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(buf)
+	writeHeader("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	//the last part is the preferred one
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create message part")
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to close message parts")
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return errors.Wrapf(err, "Failed to encode message body")
+	}
+	if err := qp.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to encode message body")
+	}
+	return nil
+}
+
+func newMessageID(fromAddress string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrapf(err, "Unable to generate message id")
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(fromAddress, "@"); at >= 0 {
+		domain = fromAddress[at+1:]
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">", nil
+}
+
+//permanentErr is a failure that will not go away by retrying
+type permanentErr struct{ error }
+
+//IsPermanentErr is true for invalid messages and SMTP 5xx replies, retrying those will not help
+func IsPermanentErr(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case permanentErr:
+		return true
+	case *textproto.Error:
+		return cause.Code >= 500
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package mailer
+
+import (
+	"net/mail"
+
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/auth"
+)
+
+//The templates used by Notifier, the template data is NotificationData
+const (
+	TemplatePasswordReset = "password-reset"
+	TemplateVerifyEmail   = "verify-email"
+	TemplateMagicLogin    = "magic-login"
+	TemplateInvite        = "invite"
+)
+
+//Recipient is where and in which locale the mail for a user is sent
+type Recipient struct {
+	Name   string
+	Email  string
+	Locale string
+}
+
+//Address formats the recipient for Message.To
+func (r Recipient) Address() string {
+	if r.Name == "" {
+		return r.Email
+	}
+	return (&mail.Address{Name: r.Name, Address: r.Email}).String()
+}
+
+//NotificationData is passed to the templates, Data holds the values of WithData (like the base URL of the app)
+type NotificationData struct {
+	User      auth.User
+	Recipient Recipient
+	Token     string
+	Data      map[string]interface{}
+}
+
+//Notifier implements auth.Notifier by rendering the Template* templates and sending them from the from address.
+//recipient provides the email address and locale of a user, since user.User has neither. Use a Queue as sender to
+//not delay the request on a slow mail server.
+func Notifier(sender Sender, renderer Renderer, from string, recipient func(user auth.User) (Recipient, error)) *notifier {
+	return &notifier{
+		sender:    sender,
+		renderer:  renderer,
+		from:      from,
+		recipient: recipient,
+		data:      map[string]interface{}{},
+	}
+}
+
+type notifier struct {
+	sender    Sender
+	renderer  Renderer
+	from      string
+	recipient func(user auth.User) (Recipient, error)
+	data      map[string]interface{}
+}
+
+//WithData adds values that are available to all templates as .Data
+func (n *notifier) WithData(data map[string]interface{}) *notifier {
+	for key, value := range data {
+		n.data[key] = value
+	}
+	return n
+}
+
+func (n *notifier) PasswordReset(user auth.User, resetToken string) error {
+	return n.send(TemplatePasswordReset, user, resetToken)
+}
+
+func (n *notifier) VerifyEmail(user auth.User, verificationToken string) error {
+	return n.send(TemplateVerifyEmail, user, verificationToken)
+}
+
+func (n *notifier) MagicLogin(user auth.User, magicToken string) error {
+	return n.send(TemplateMagicLogin, user, magicToken)
+}
+
+func (n *notifier) Invite(user auth.User, inviteToken string) error {
+	return n.send(TemplateInvite, user, inviteToken)
+}
+
+func (n *notifier) send(templateName string, user auth.User, token string) error {
+	recipient, err := n.recipient(user)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get mail recipient")
+	}
+
+	content, err := n.renderer.Render(templateName, recipient.Locale, NotificationData{
+		User:      user,
+		Recipient: recipient,
+		Token:     token,
+		Data:      n.data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return n.sender.Send(Message{
+		From:    n.from,
+		To:      []string{recipient.Address()},
+		Subject: content.Subject,
+		Text:    content.Text,
+		HTML:    content.HTML,
+	})
+}
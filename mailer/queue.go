@@ -0,0 +1,130 @@
+package mailer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultMaxAttempts  = 5
+	DefaultRetryBackoff = 30 * time.Second
+)
+
+var (
+	ErrQueueFull   = errors.New("Mail queue is full")
+	ErrQueueClosed = errors.New("Mail queue is closed")
+)
+
+//Queue sends through sender in the background with the given number of workers, Send only fails for invalid messages
+//or when more than size messages are waiting. Failed sends are retried with exponential backoff (see WithRetries),
+//except for permanent errors (see IsPermanentErr).
+func Queue(sender Sender, size, workers int) *queue {
+	if workers <= 0 {
+		workers = 1
+	}
+	q := &queue{
+		sender:       sender,
+		messages:     make(chan Message, size),
+		maxAttempts:  DefaultMaxAttempts,
+		retryBackoff: DefaultRetryBackoff,
+	}
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+type queue struct {
+	sender   Sender
+	messages chan Message
+	workers  sync.WaitGroup
+
+	closeLock sync.RWMutex
+	closed    bool
+
+	maxAttempts    int
+	retryBackoff   time.Duration
+	failureHandler func(msg Message, err error)
+}
+
+//WithRetries overrides DefaultMaxAttempts and DefaultRetryBackoff, the backoff doubles after every attempt. It must
+//be called before the first Send.
+func (q *queue) WithRetries(maxAttempts int, backoff time.Duration) *queue {
+	q.maxAttempts = maxAttempts
+	q.retryBackoff = backoff
+	return q
+}
+
+//WithFailureHandler is called for messages that could not be sent after all attempts, it must be called before the
+//first Send
+func (q *queue) WithFailureHandler(handler func(msg Message, err error)) *queue {
+	q.failureHandler = handler
+	return q
+}
+
+func (q *queue) Send(msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	q.closeLock.RLock()
+	defer q.closeLock.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+//Close stops accepting messages and waits until the queued messages are sent, including their retries
+func (q *queue) Close() {
+	q.closeLock.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.closeLock.Unlock()
+
+	q.workers.Wait()
+}
+
+func (q *queue) work() {
+	defer q.workers.Done()
+	for msg := range q.messages {
+		q.deliver(msg)
+	}
+}
+
+func (q *queue) deliver(msg Message) {
+	logger := logrus.WithField("subject", msg.Subject).WithField("to", msg.To)
+
+	backoff := q.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := q.sender.Send(msg)
+		if err == nil {
+			logger.WithField("attempt", attempt).Debug("Sent mail")
+			return
+		}
+
+		if IsPermanentErr(err) || attempt >= q.maxAttempts {
+			logger.WithError(err).WithField("attempt", attempt).Error("Failed to send mail, giving up")
+			if q.failureHandler != nil {
+				q.failureHandler(msg, err)
+			}
+			return
+		}
+
+		logger.WithError(err).WithField("attempt", attempt).WithField("retry-in", backoff).Warn("Failed to send mail, retrying")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,119 @@
+package mailer
+
+import (
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//failingSender fails with the given errors in order before sending
+type failingSender struct {
+	lock     sync.Mutex
+	errs     []error
+	attempts []time.Time
+}
+
+func (s *failingSender) Send(msg Message) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attempts = append(s.attempts, time.Now())
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *failingSender) Attempts() []time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]time.Time{}, s.attempts...)
+}
+
+type failures struct {
+	lock sync.Mutex
+	errs []error
+}
+
+func (f *failures) handle(msg Message, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.errs = append(f.errs, err)
+}
+
+func TestQueueRetries(t *testing.T) {
+	temporary := errors.Wrapf(&textproto.Error{Code: 451, Msg: "Try again later"}, "SMTP server rejected recipient")
+	sender := &failingSender{errs: []error{temporary, temporary}}
+	failed := &failures{}
+	q := Queue(sender, 10, 1).WithRetries(5, 10*time.Millisecond).WithFailureHandler(failed.handle)
+
+	if err := q.Send(testMessage()); err != nil {
+		t.Fatalf("Expected the message to be queued, got %s", err)
+	}
+	q.Close()
+
+	attempts := sender.Attempts()
+	if len(attempts) != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", len(attempts))
+	}
+	//the backoff doubles after every attempt
+	if gap := attempts[1].Sub(attempts[0]); gap < 10*time.Millisecond {
+		t.Fatalf("Expected the first retry after the backoff, got %s", gap)
+	}
+	if gap := attempts[2].Sub(attempts[1]); gap < 20*time.Millisecond {
+		t.Fatalf("Expected the second retry after twice the backoff, got %s", gap)
+	}
+	if len(failed.errs) != 0 {
+		t.Fatalf("Expected no failures, got %v", failed.errs)
+	}
+}
+
+func TestQueueGivesUpAfterMaxAttempts(t *testing.T) {
+	temporary := &textproto.Error{Code: 421, Msg: "Service not available"}
+	sender := &failingSender{errs: []error{temporary, temporary, temporary}}
+	failed := &failures{}
+	q := Queue(sender, 10, 1).WithRetries(2, time.Millisecond).WithFailureHandler(failed.handle)
+
+	q.Send(testMessage())
+	q.Close()
+
+	if attempts := len(sender.Attempts()); attempts != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", attempts)
+	}
+	if len(failed.errs) != 1 {
+		t.Fatalf("Expected the failure handler to be called once, got %d", len(failed.errs))
+	}
+}
+
+func TestQueuePermanentErr(t *testing.T) {
+	permanent := errors.Wrapf(&textproto.Error{Code: 550, Msg: "No such user"}, "SMTP server rejected recipient")
+	sender := &failingSender{errs: []error{permanent}}
+	failed := &failures{}
+	q := Queue(sender, 10, 1).WithRetries(5, time.Millisecond).WithFailureHandler(failed.handle)
+
+	q.Send(testMessage())
+	q.Close()
+
+	if attempts := len(sender.Attempts()); attempts != 1 {
+		t.Fatalf("Expected a 5xx reply not to be retried, got %d attempts", attempts)
+	}
+	if len(failed.errs) != 1 || errors.Cause(failed.errs[0]) != errors.Cause(permanent) {
+		t.Fatalf("Expected the failure handler to get the 5xx error, got %v", failed.errs)
+	}
+}
+
+func TestQueueRejectsInvalidMessage(t *testing.T) {
+	sender := &failingSender{}
+	q := Queue(sender, 10, 1)
+	defer q.Close()
+
+	msg := testMessage()
+	msg.To = nil
+	if err := q.Send(msg); !IsPermanentErr(err) {
+		t.Fatalf("Expected a permanent error for a message without recipients, got %v", err)
+	}
+}
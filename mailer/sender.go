@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Sender delivers a message, see IsPermanentErr for errors that should not be retried
+type Sender interface {
+	Send(msg Message) error
+}
+
+//MemorySender captures messages instead of sending them, it is meant for tests
+func MemorySender() *memorySender {
+	return &memorySender{}
+}
+
+type memorySender struct {
+	lock     sync.RWMutex
+	messages []Message
+}
+
+func (s *memorySender) Send(msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+//Messages returns the captured messages, oldest first
+func (s *memorySender) Messages() []Message {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]Message{}, s.messages...)
+}
+
+func (s *memorySender) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.messages = nil
+}
+
+//MaildirSender delivers messages into a local maildir (https://cr.yp.to/proto/maildir.html), the tmp, new and cur
+//subdirectories are created when needed. Every message is a complete .eml file that mail clients can open, which is
+//handy during development.
+func MaildirSender(dir string) *maildirSender {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	return &maildirSender{dir: dir, hostname: hostname}
+}
+
+type maildirSender struct {
+	dir      string
+	hostname string
+	counter  uint64
+}
+
+func (s *maildirSender) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(s.dir, sub), 0700); err != nil {
+			return errors.Wrapf(err, "Failed to create maildir")
+		}
+	}
+
+	//written to tmp first so that readers of new never see a partial message
+	now := time.Now()
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s.eml", now.Unix(), now.Nanosecond()/1000, os.Getpid(), atomic.AddUint64(&s.counter, 1), s.hostname)
+	tmpPath := filepath.Join(s.dir, "tmp", name)
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.Wrapf(err, "Failed to write message")
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, "new", name)); err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "Failed to deliver message")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultSMTPTimeout = 30 * time.Second
+
+//SMTPSender sends through the SMTP server at addr (host:port), auth may be nil for servers that do not require it.
+//STARTTLS is used when the server supports it.
+func SMTPSender(addr string, auth smtp.Auth) *smtpSender {
+	return &smtpSender{
+		addr:    addr,
+		auth:    auth,
+		timeout: DefaultSMTPTimeout,
+	}
+}
+
+type smtpSender struct {
+	addr       string
+	auth       smtp.Auth
+	timeout    time.Duration
+	helloName  string
+	tlsConfig  *tls.Config
+	requireTLS bool
+}
+
+//WithTimeout limits the whole conversation with the server for a single message
+func (s *smtpSender) WithTimeout(timeout time.Duration) *smtpSender {
+	s.timeout = timeout
+	return s
+}
+
+//WithHelloName overrides the name sent in EHLO, which is "localhost" by default
+func (s *smtpSender) WithHelloName(name string) *smtpSender {
+	s.helloName = name
+	return s
+}
+
+//WithTLS sets the config for STARTTLS and, if required, refuses to send to servers without STARTTLS
+func (s *smtpSender) WithTLS(config *tls.Config, required bool) *smtpSender {
+	s.tlsConfig = config
+	s.requireTLS = required
+	return s
+}
+
+func (s *smtpSender) Send(msg Message) error {
+	from, to, err := msg.Envelope()
+	if err != nil {
+		return err
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid SMTP address '%s'", s.addr)
+	}
+	conn, err := net.DialTimeout("tcp", s.addr, s.timeout)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to connect to SMTP server")
+	}
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		conn.Close()
+		return errors.Wrapf(err, "Failed to set SMTP deadline")
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrapf(err, "Failed to start SMTP session")
+	}
+	defer client.Close()
+
+	if s.helloName != "" {
+		if err := client.Hello(s.helloName); err != nil {
+			return errors.Wrapf(err, "SMTP hello failed")
+		}
+	}
+
+	if hasTLS, _ := client.Extension("STARTTLS"); hasTLS {
+		config := &tls.Config{ServerName: host}
+		if s.tlsConfig != nil {
+			config = s.tlsConfig.Clone()
+			if config.ServerName == "" {
+				config.ServerName = host
+			}
+		}
+		if err := client.StartTLS(config); err != nil {
+			return errors.Wrapf(err, "SMTP STARTTLS failed")
+		}
+	} else if s.requireTLS {
+		return errors.New("SMTP server does not support STARTTLS")
+	}
+
+	if s.auth != nil {
+		if hasAuth, _ := client.Extension("AUTH"); !hasAuth {
+			return errors.New("SMTP server does not support AUTH")
+		}
+		if err := client.Auth(s.auth); err != nil {
+			return errors.Wrapf(err, "SMTP authentication failed")
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return errors.Wrapf(err, "SMTP server rejected sender")
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return errors.Wrapf(err, "SMTP server rejected recipient '%s'", rcpt)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return errors.Wrapf(err, "SMTP server rejected data")
+	}
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrapf(err, "Failed to write message")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrapf(err, "SMTP server rejected message")
+	}
+
+	//the message is accepted at this point, a failing QUIT must not cause a resend
+	client.Quit()
+	return nil
+}
@@ -0,0 +1,200 @@
+package mailer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//stubSMTPServer is an in-process SMTP server that accepts (or rejects) mail without STARTTLS
+type stubSMTPServer struct {
+	listener net.Listener
+	//rcptReply overrides the reply to RCPT TO, like "550 No such user"
+	rcptReply string
+
+	lock     sync.Mutex
+	received []stubMail
+}
+
+type stubMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func newStubSMTPServer(t *testing.T) *stubSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	s := &stubSMTPServer{listener: listener}
+	go s.serve()
+	return s
+}
+
+func (s *stubSMTPServer) Addr() string { return s.listener.Addr().String() }
+func (s *stubSMTPServer) Close()       { s.listener.Close() }
+
+func (s *stubSMTPServer) Received() []stubMail {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]stubMail{}, s.received...)
+}
+
+func (s *stubSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *stubSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 stub ESMTP")
+	current := stubMail{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			//no STARTTLS and no AUTH
+			reply("250-stub")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(command, "HELO"):
+			reply("250 stub")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			current = stubMail{from: envelopeAddress(line)}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			if s.rcptReply != "" {
+				reply(s.rcptReply)
+				continue
+			}
+			current.to = append(current.to, envelopeAddress(line))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data := strings.Builder{}
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			current.data = data.String()
+			s.lock.Lock()
+			s.received = append(s.received, current)
+			s.lock.Unlock()
+			reply("250 OK queued")
+		case command == "RSET" || command == "NOOP":
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+//envelopeAddress returns the address between the angle brackets, ignoring parameters like BODY=8BITMIME
+func envelopeAddress(line string) string {
+	start, end := strings.Index(line, "<"), strings.Index(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+func testMessage() Message {
+	return Message{
+		From:    "App <app@example.com>",
+		To:      []string{"Jane <jane@example.com>"},
+		Subject: "Hello",
+		Text:    "Hello Jane",
+	}
+}
+
+func TestSMTPSenderPlain(t *testing.T) {
+	server := newStubSMTPServer(t)
+	defer server.Close()
+
+	if err := SMTPSender(server.Addr(), nil).WithTimeout(5 * time.Second).Send(testMessage()); err != nil {
+		t.Fatalf("Expected the message to be sent, got %s", err)
+	}
+
+	received := server.Received()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(received))
+	}
+	if received[0].from != "app@example.com" || len(received[0].to) != 1 || received[0].to[0] != "jane@example.com" {
+		t.Fatalf("Unexpected envelope %s -> %v", received[0].from, received[0].to)
+	}
+	if !strings.Contains(received[0].data, "Subject: Hello\r\n") || !strings.Contains(received[0].data, "Hello Jane") {
+		t.Fatalf("Unexpected message data %q", received[0].data)
+	}
+}
+
+func TestSMTPSenderWithoutSTARTTLS(t *testing.T) {
+	server := newStubSMTPServer(t)
+	defer server.Close()
+
+	//the TLS config is only used when the server offers STARTTLS
+	if err := SMTPSender(server.Addr(), nil).WithTLS(&tls.Config{}, false).Send(testMessage()); err != nil {
+		t.Fatalf("Expected the message to be sent without STARTTLS, got %s", err)
+	}
+
+	err := SMTPSender(server.Addr(), nil).WithTLS(&tls.Config{}, true).Send(testMessage())
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Expected STARTTLS to be required, got %v", err)
+	}
+	if len(server.Received()) != 1 {
+		t.Fatalf("Expected only the first message to be sent, got %d", len(server.Received()))
+	}
+}
+
+func TestSMTPSenderRejectedRecipient(t *testing.T) {
+	tests := []struct {
+		reply         string
+		wantPermanent bool
+	}{
+		{reply: "550 No such user", wantPermanent: true},
+		{reply: "451 Try again later", wantPermanent: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.reply, func(t *testing.T) {
+			server := newStubSMTPServer(t)
+			defer server.Close()
+			server.rcptReply = test.reply
+
+			err := SMTPSender(server.Addr(), nil).Send(testMessage())
+			if err == nil {
+				t.Fatalf("Expected the recipient to be rejected")
+			}
+			if IsPermanentErr(err) != test.wantPermanent {
+				t.Fatalf("Expected IsPermanentErr to be %t for %s", test.wantPermanent, err)
+			}
+		})
+	}
+}
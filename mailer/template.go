@@ -0,0 +1,192 @@
+package mailer
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/pkg/errors"
+)
+
+//Renderer renders the named template in the locale, falling back to less specific locales
+type Renderer interface {
+	Render(name, locale string, data interface{}) (Content, error)
+}
+
+//Content is a rendered template, Text or HTML is empty if the template has none
+type Content struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+//TemplateRenderer renders templates added with Add or LoadDir. A locale like "pt-BR" falls back to "pt" and then to
+//defaultLocale.
+func TemplateRenderer(defaultLocale string) *templateRenderer {
+	return &templateRenderer{
+		defaultLocale: normalizeLocale(defaultLocale),
+		templates:     map[string]localizedTemplate{},
+	}
+}
+
+type templateRenderer struct {
+	lock          sync.RWMutex
+	defaultLocale string
+	templates     map[string]localizedTemplate
+}
+
+//localizedTemplate is a single template in a single locale, text or html is nil if it has none
+type localizedTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+const (
+	subjectFileSuffix = ".subject.txt"
+	textFileSuffix    = ".txt"
+	htmlFileSuffix    = ".html"
+)
+
+//Add parses the subject, text and html templates of name in the locale, text or html may be empty but not both.
+//The subject and text templates use text/template, html uses html/template.
+func (t *templateRenderer) Add(locale, name, subject, text, html string) error {
+	if text == "" && html == "" {
+		return errors.Errorf("Template '%s' (%s) has neither text nor html", name, locale)
+	}
+
+	parsed := localizedTemplate{}
+	var err error
+	if parsed.subject, err = texttemplate.New(name + subjectFileSuffix).Parse(subject); err != nil {
+		return errors.Wrapf(err, "Failed to parse subject of template '%s' (%s)", name, locale)
+	}
+	if text != "" {
+		if parsed.text, err = texttemplate.New(name + textFileSuffix).Parse(text); err != nil {
+			return errors.Wrapf(err, "Failed to parse text of template '%s' (%s)", name, locale)
+		}
+	}
+	if html != "" {
+		if parsed.html, err = htmltemplate.New(name + htmlFileSuffix).Parse(html); err != nil {
+			return errors.Wrapf(err, "Failed to parse html of template '%s' (%s)", name, locale)
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.templates[templateKey(normalizeLocale(locale), name)] = parsed
+	return nil
+}
+
+//LoadDir adds the templates in dir, which has a subdirectory per locale. A template consists of <name>.subject.txt
+//with <name>.txt and/or <name>.html, like en/invite.subject.txt, en/invite.txt and en/invite.html.
+func (t *templateRenderer) LoadDir(dir string) error {
+	localeDirs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read template directory")
+	}
+
+	for _, localeDir := range localeDirs {
+		if !localeDir.IsDir() {
+			continue
+		}
+		locale := localeDir.Name()
+		files, err := filepath.Glob(filepath.Join(dir, locale, "*"+subjectFileSuffix))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to list templates of locale '%s'", locale)
+		}
+
+		for _, subjectFile := range files {
+			base := strings.TrimSuffix(subjectFile, subjectFileSuffix)
+			subject, err := ioutil.ReadFile(subjectFile)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to read template")
+			}
+			text, err := readOptionalFile(base + textFileSuffix)
+			if err != nil {
+				return err
+			}
+			html, err := readOptionalFile(base + htmlFileSuffix)
+			if err != nil {
+				return err
+			}
+
+			if err := t.Add(locale, filepath.Base(base), string(subject), text, html); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *templateRenderer) Render(name, locale string, data interface{}) (Content, error) {
+	tmpl, ok := t.find(name, locale)
+	if !ok {
+		return Content{}, errors.Errorf("Template '%s' not found for locale '%s'", name, locale)
+	}
+
+	content := Content{}
+	buf := &bytes.Buffer{}
+	if err := tmpl.subject.Execute(buf, data); err != nil {
+		return Content{}, errors.Wrapf(err, "Failed to render subject of template '%s'", name)
+	}
+	//template files usually end with a newline, which is not allowed in a header
+	content.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	if tmpl.text != nil {
+		buf.Reset()
+		if err := tmpl.text.Execute(buf, data); err != nil {
+			return Content{}, errors.Wrapf(err, "Failed to render text of template '%s'", name)
+		}
+		content.Text = buf.String()
+	}
+	if tmpl.html != nil {
+		buf.Reset()
+		if err := tmpl.html.Execute(buf, data); err != nil {
+			return Content{}, errors.Wrapf(err, "Failed to render html of template '%s'", name)
+		}
+		content.HTML = buf.String()
+	}
+	return content, nil
+}
+
+func (t *templateRenderer) find(name, locale string) (localizedTemplate, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	locale = normalizeLocale(locale)
+	candidates := []string{locale}
+	if dash := strings.Index(locale, "-"); dash > 0 {
+		candidates = append(candidates, locale[:dash])
+	}
+	candidates = append(candidates, t.defaultLocale)
+
+	for _, candidate := range candidates {
+		if tmpl, ok := t.templates[templateKey(candidate, name)]; ok {
+			return tmpl, true
+		}
+	}
+	return localizedTemplate{}, false
+}
+
+func templateKey(locale, name string) string { return locale + "/" + name }
+
+//normalizeLocale makes "pt_BR" and "pt-br" the same locale
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
+
+func readOptionalFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "Failed to read template")
+	}
+	return string(data), nil
+}
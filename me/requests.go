@@ -0,0 +1,39 @@
+package me
+
+import (
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/user"
+)
+
+type RequestFactory interface {
+	UpdateProfile() UpdateProfileRequest
+	ChangePassword() ChangePasswordRequest
+	ChangeEmail() ChangeEmailRequest
+	DeleteAccount() DeleteAccountRequest
+}
+
+type UpdateProfileRequest interface {
+	Validate() error
+	//ToUser returns the current user with the profile fields updated, changes to the ID, email, admin, email
+	//verification or status are rejected
+	ToUser(current user.User) user.User
+}
+
+type ChangePasswordRequest interface {
+	Validate() error
+	CurrentPassword() string
+	NewPassword() string
+}
+
+type ChangeEmailRequest interface {
+	Validate() error
+	CurrentPassword() string
+	//ToUser returns the current user with the new email, the new email is marked as not verified (see
+	//auth.Service.ChangeEmail)
+	ToUser(current user.User) auth.User
+}
+
+type DeleteAccountRequest interface {
+	Validate() error
+	CurrentPassword() string
+}
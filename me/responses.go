@@ -0,0 +1,15 @@
+package me
+
+import "github.com/francoishill/gomponents/user"
+
+type ResponseFactory interface {
+	Profile(user user.User) ProfileResponse
+	PasswordChanged() PasswordChangedResponse
+	EmailChanged(user user.User, verificationSent bool) EmailChangedResponse
+	AccountDeleted(userID string) AccountDeletedResponse
+}
+
+type ProfileResponse interface{}
+type PasswordChangedResponse interface{}
+type EmailChangedResponse interface{}
+type AccountDeletedResponse interface{}
@@ -0,0 +1,193 @@
+package me
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/audit"
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
+	"github.com/francoishill/gomponents/user"
+)
+
+//Router lets the authenticated user manage their own account. Changing the password or email and deleting the
+//account requires the current password. Impersonating admins can only read the profile. auditService may be nil.
+func Router(
+	authService auth.Service, authMiddleware auth.Middleware,
+	requestFactory RequestFactory, responseFactory ResponseFactory,
+	rendering rendering.Service,
+	userRepoFactory user.RepoFactory,
+	auditService audit.Service) *chi.Mux {
+
+	r := chi.NewRouter()
+
+	r.Use(authMiddleware.Authenticate()...)
+	r.Use(authMiddleware.LoadUser())
+
+	currentUser := func(w http.ResponseWriter, r *http.Request) (auth.User, bool) {
+		u, ok := authMiddleware.GetContextUser(r.Context()).(auth.User)
+		if !ok {
+			rendering.RenderError(w, r, errors.New("User does not implement auth.User"), nil, http.StatusInternalServerError)
+			return nil, false
+		}
+		return u, true
+	}
+
+	record := func(r *http.Request, action audit.Action, userID string, err error) {
+		if auditService == nil {
+			return
+		}
+		event := audit.NewEvent(request.ClientContext(r), action, audit.OutcomeSuccess, userID, userID)
+		if err != nil {
+			event.Outcome = audit.OutcomeFailure
+			event = event.WithReason(err.Error())
+		}
+		auditService.Record(event)
+	}
+
+	update := func(w http.ResponseWriter, r *http.Request, updatedUser user.User) bool {
+		userRepo := userRepoFactory.Repo()
+		if err := userRepo.Update(updatedUser); err != nil {
+			if userRepo.IsDupErr(err) {
+				rendering.RenderError(w, r, clienterror.NewError(errors.New("Email is already in use"), http.StatusConflict), nil, http.StatusConflict)
+				return false
+			}
+			rendering.RenderError(w, r, errors.Wrapf(err, "Failed to update user"), nil, http.StatusInternalServerError)
+			return false
+		}
+		return true
+	}
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		render.Respond(w, r, responseFactory.Profile(authMiddleware.GetContextUser(r.Context())))
+	})
+
+	//the impersonating admin can look but not change the account
+	mutate := r.With(authMiddleware.RejectImpersonation())
+
+	mutate.Patch("/", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.UpdateProfile()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		updatedUser := body.ToUser(current)
+		if err := checkProfileUpdate(current, updatedUser); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+		if !update(w, r, updatedUser) {
+			return
+		}
+		record(r, audit.ActionProfileUpdate, current.ID(), nil)
+		render.Respond(w, r, responseFactory.Profile(updatedUser))
+	})
+
+	mutate.Post("/password", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.ChangePassword()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		if err := authService.ChangePassword(request.ClientContext(r), current, body.CurrentPassword(), body.NewPassword()); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+		render.Respond(w, r, responseFactory.PasswordChanged())
+	})
+
+	mutate.Post("/email", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.ChangeEmail()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		updatedUser := body.ToUser(current)
+		if updatedUser.IsAdmin() != current.IsAdmin() || updatedUser.Status() != current.Status() {
+			rendering.RenderError(w, r, errors.New("Only the email can be changed"), nil, http.StatusBadRequest)
+			return
+		}
+
+		changedUser, verificationSent, err := authService.ChangeEmail(request.ClientContext(r), current, body.CurrentPassword(), updatedUser)
+		record(r, audit.ActionEmailChange, current.ID(), err)
+		if err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+		render.Respond(w, r, responseFactory.EmailChanged(changedUser, verificationSent))
+	})
+
+	mutate.Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.DeleteAccount()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		if err := authService.ConfirmPassword(request.ClientContext(r), current, body.CurrentPassword()); err != nil {
+			record(r, audit.ActionAccountDelete, current.ID(), err)
+			rendering.RenderError(w, r, err, nil, http.StatusForbidden)
+			return
+		}
+
+		//soft delete like the admin router, the user is kept with user.StatusDeleted
+		if _, err := authService.ChangeStatus(current.ID(), user.StatusDeleted); err != nil {
+			record(r, audit.ActionAccountDelete, current.ID(), err)
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+		record(r, audit.ActionAccountDelete, current.ID(), nil)
+		//ChangeStatus only revokes the tokens
+		if err := authService.RevokeAllTokens(current.ID()); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+		render.Respond(w, r, responseFactory.AccountDeleted(current.ID()))
+	})
+
+	return r
+}
+
+//checkProfileUpdate rejects changes that have their own endpoint or are up to admins
+func checkProfileUpdate(current auth.User, updatedUser user.User) error {
+	switch {
+	case updatedUser.ID() != current.ID():
+		return errors.New("The user ID cannot be changed")
+	case updatedUser.IsAdmin() != current.IsAdmin():
+		return errors.New("Admin permission cannot be changed")
+	case updatedUser.IsEmailVerified() != current.IsEmailVerified():
+		return errors.New("Email verification cannot be changed")
+	case updatedUser.Status() != current.Status():
+		return errors.New("The account status cannot be changed")
+	}
+	currentEmailUser, isEmailUser := current.(auth.EmailUser)
+	updatedEmailUser, isUpdatedEmailUser := updatedUser.(auth.EmailUser)
+	if isEmailUser && isUpdatedEmailUser && updatedEmailUser.Email() != currentEmailUser.Email() {
+		return errors.New("Use the email endpoint to change the email")
+	}
+	return nil
+}
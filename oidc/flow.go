@@ -0,0 +1,174 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+//Identity is the user as known by the provider, taken from the validated ID token
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Claims        map[string]interface{}
+}
+
+//AuthCodeURL builds the authorization request with a PKCE (S256) challenge of codeVerifier
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.Discovery()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+//Exchange swaps the authorization code for tokens and returns the identity of the validated ID token
+func (p *Provider) Exchange(code, codeVerifier, nonce string) (Identity, error) {
+	discovery, err := p.Discovery()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, errors.Wrapf(err, "Failed to create token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return Identity{}, errors.Wrapf(err, "Token request to %s failed", p.config.Name)
+	}
+	defer resp.Body.Close()
+
+	tokens := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return Identity{}, errors.Wrapf(err, "Failed to decode token response of %s", p.config.Name)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return Identity{}, errors.Errorf("Token request to %s failed with status %d: %s %s", p.config.Name, resp.StatusCode, tokens.Error, tokens.ErrorDesc)
+	}
+	if tokens.IDToken == "" {
+		return Identity{}, errors.Errorf("Token response of %s has no id_token", p.config.Name)
+	}
+
+	return p.VerifyIDToken(tokens.IDToken, nonce)
+}
+
+var allowedIDTokenAlgs = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+}
+
+//VerifyIDToken checks the signature against the provider JWKS and the iss, aud, exp and nonce claims
+func (p *Provider) VerifyIDToken(idToken, nonce string) (Identity, error) {
+	discovery, err := p.Discovery()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	parsed, err := jwt.Parse(idToken, func(t *jwt.Token) (interface{}, error) {
+		if !allowedIDTokenAlgs[t.Method.Alg()] {
+			return nil, errors.Errorf("Unexpected signing algorithm '%s'", t.Method.Alg())
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.publicKey(kid)
+	})
+	if err != nil {
+		return Identity{}, errors.Wrapf(err, "Invalid ID token")
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return Identity{}, errors.New("Invalid ID token")
+	}
+	if !claims.VerifyIssuer(discovery.Issuer, true) {
+		return Identity{}, errors.New("Invalid ID token, issuer mismatch")
+	}
+	if !audienceContains(claims["aud"], p.config.ClientID) {
+		return Identity{}, errors.New("Invalid ID token, audience mismatch")
+	}
+	if _, hasExp := claims["exp"]; !hasExp {
+		return Identity{}, errors.New("Invalid ID token, exp is missing")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return Identity{}, errors.New("Invalid ID token, nonce mismatch")
+	}
+
+	identity := Identity{
+		Provider: p.config.Name,
+		Claims:   claims,
+	}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Name, _ = claims["name"].(string)
+	if identity.Subject == "" {
+		return Identity{}, errors.New("Invalid ID token, sub is missing")
+	}
+	return identity, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, _ := a.(string); s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomString(byteLength int) (string, error) {
+	b := make([]byte, byteLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrapf(err, "Unable to generate random value")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
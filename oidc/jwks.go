@@ -0,0 +1,126 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+//keys are reloaded on an unknown kid (providers rotate keys), but not more often than this
+const jwksMinRefreshInterval = time.Minute
+
+type keySet struct {
+	lock     sync.Mutex
+	keys     map[string]interface{}
+	loadedAt time.Time
+}
+
+func (p *Provider) publicKey(kid string) (interface{}, error) {
+	p.keys.lock.Lock()
+	defer p.keys.lock.Unlock()
+
+	if key, ok := p.keys.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keys.loadedAt) < jwksMinRefreshInterval {
+		return nil, errors.Errorf("Unknown key id '%s'", kid)
+	}
+
+	discovery, err := p.Discovery()
+	if err != nil {
+		return nil, err
+	}
+
+	set := jsonWebKeySet{}
+	if err := p.getJSON(discovery.JWKSURI, &set); err != nil {
+		return nil, errors.Wrapf(err, "Failed to load JWKS of %s", p.config.Name)
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			//skip keys of unsupported types instead of failing all of them
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys.keys = keys
+	p.keys.loadedAt = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, errors.Errorf("Unknown key id '%s'", kid)
+	}
+	return key, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("Unsupported curve '%s'", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.Errorf("Unsupported key type '%s'", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid base64url value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
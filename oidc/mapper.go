@@ -0,0 +1,9 @@
+package oidc
+
+import "github.com/francoishill/gomponents/auth"
+
+//IdentityMapper maps an external identity to a user of the app, either by linking it to an existing user (like the
+//one with the same verified email) or by creating a new user
+type IdentityMapper interface {
+	LoadOrCreateUser(identity Identity) (auth.User, error)
+}
@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//ProviderConfig configures a single OpenID Connect provider (like Google or a corporate IdP). Discovery is loaded from
+//IssuerURL + "/.well-known/openid-configuration" unless Discovery is set.
+type ProviderConfig struct {
+	//Name is used in the routes, like /{name}/login
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	//Scopes defaults to openid, email and profile
+	Scopes    []string
+	Discovery *Discovery
+	//InsecureStateCookie sends the login state cookie without the Secure flag, only for local development over plain
+	//HTTP. The cookie is Secure by default, also behind a proxy that terminates TLS.
+	InsecureStateCookie bool
+}
+
+//Discovery is the subset of the provider metadata that is used, see https://openid.net/specs/openid-connect-discovery-1_0.html
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+const discoveryRefreshInterval = 24 * time.Hour
+
+//NewProvider uses httpClient for discovery, JWKS and token requests, pass nil to use http.DefaultClient
+func NewProvider(config ProviderConfig, httpClient *http.Client) *Provider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		config:     config,
+		httpClient: httpClient,
+		keys:       &keySet{},
+	}
+}
+
+type Provider struct {
+	config     ProviderConfig
+	httpClient *http.Client
+	keys       *keySet
+
+	lock        sync.Mutex
+	discovery   *Discovery
+	discoveryAt time.Time
+}
+
+func (p *Provider) Name() string { return p.config.Name }
+
+func (p *Provider) Discovery() (Discovery, error) {
+	if p.config.Discovery != nil {
+		return *p.config.Discovery, nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.discovery != nil && time.Since(p.discoveryAt) < discoveryRefreshInterval {
+		return *p.discovery, nil
+	}
+
+	discoveryURL := strings.TrimRight(p.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	discovery := &Discovery{}
+	if err := p.getJSON(discoveryURL, discovery); err != nil {
+		return Discovery{}, errors.Wrapf(err, "Failed to load OIDC discovery of %s", p.config.Name)
+	}
+	if discovery.Issuer != strings.TrimRight(p.config.IssuerURL, "/") && discovery.Issuer != p.config.IssuerURL {
+		return Discovery{}, errors.Errorf("OIDC discovery issuer '%s' does not match configured issuer '%s'", discovery.Issuer, p.config.IssuerURL)
+	}
+
+	p.discovery = discovery
+	p.discoveryAt = time.Now()
+	return *discovery, nil
+}
+
+func (p *Provider) getJSON(url string, dest interface{}) error {
+	resp, err := p.httpClient.Get(url)
+	if err != nil {
+		return errors.Wrapf(err, "Request to %s failed", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Request to %s failed with status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return errors.Wrapf(err, "Failed to decode response of %s", url)
+	}
+	return nil
+}
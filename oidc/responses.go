@@ -0,0 +1,14 @@
+package oidc
+
+import (
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/token"
+)
+
+type ResponseFactory interface {
+	LoggedIn(user auth.User, tokens token.Pair) LoggedInResponse
+	MFARequired(user auth.User, pendingToken string) MFARequiredResponse
+}
+
+type LoggedInResponse interface{}
+type MFARequiredResponse interface{}
@@ -0,0 +1,128 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/encryption"
+	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
+)
+
+//Router serves GET /{provider}/login (redirects to the provider) and GET /{provider}/callback (the RedirectURL of the
+//provider), the cipher protects the login state cookie in between
+func Router(
+	rendering rendering.Service, authService auth.Service,
+	providers []*Provider, cipher encryption.Cipher,
+	identityMapper IdentityMapper, responseFactory ResponseFactory) *chi.Mux {
+
+	providersByName := map[string]*Provider{}
+	for _, p := range providers {
+		providersByName[p.Name()] = p
+	}
+
+	r := chi.NewRouter()
+
+	r.Route("/{provider}", func(r chi.Router) {
+		r.Get("/login", func(w http.ResponseWriter, r *http.Request) {
+			provider, ok := getProvider(w, r, rendering, providersByName)
+			if !ok {
+				return
+			}
+
+			state, err := newLoginState(provider.Name())
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			authURL, err := provider.AuthCodeURL(state.State, state.Nonce, state.CodeVerifier)
+			if err != nil {
+				rendering.RenderError(w, r, errors.Wrapf(err, "Failed to build authorization URL"), nil, http.StatusBadGateway)
+				return
+			}
+			if err := setStateCookie(w, cipher, state, !provider.config.InsecureStateCookie); err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+
+			http.Redirect(w, r, authURL, http.StatusFound)
+		})
+
+		r.Get("/callback", func(w http.ResponseWriter, r *http.Request) {
+			provider, ok := getProvider(w, r, rendering, providersByName)
+			if !ok {
+				return
+			}
+
+			if providerErr := r.URL.Query().Get("error"); providerErr != "" {
+				tmpErr := errors.Errorf("Login was rejected by %s: %s", provider.Name(), providerErr)
+				rendering.RenderError(w, r, tmpErr, nil, http.StatusUnauthorized)
+				return
+			}
+			code, ok := request.RequiredQueryParam(w, r, "code", rendering)
+			if !ok {
+				return
+			}
+			stateParam, ok := request.RequiredQueryParam(w, r, "state", rendering)
+			if !ok {
+				return
+			}
+
+			state, err := popStateCookie(w, r, cipher)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+			if state.Provider != provider.Name() || subtle.ConstantTimeCompare([]byte(state.State), []byte(stateParam)) != 1 {
+				rendering.RenderError(w, r, errors.New("Login state mismatch"), nil, http.StatusBadRequest)
+				return
+			}
+
+			identity, err := provider.Exchange(code, state.CodeVerifier, state.Nonce)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
+				return
+			}
+
+			user, err := identityMapper.LoadOrCreateUser(identity)
+			if err != nil {
+				rendering.RenderError(w, r, errors.Wrapf(err, "Failed to load user of %s identity", provider.Name()), nil, http.StatusUnauthorized)
+				return
+			}
+
+			tokens, err := authService.ExternalLogin(request.ClientContext(r), user)
+			if pendingToken, isMFARequired := authService.IsMFARequiredErr(err); isMFARequired {
+				render.Respond(w, r, responseFactory.MFARequired(user, pendingToken))
+				return
+			}
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusUnauthorized)
+				return
+			}
+
+			render.Respond(w, r, responseFactory.LoggedIn(user, tokens))
+		})
+	})
+
+	return r
+}
+
+func getProvider(w http.ResponseWriter, r *http.Request, rendering rendering.Service, providersByName map[string]*Provider) (*Provider, bool) {
+	name, ok := request.RequiredURLParam(w, r, "provider", rendering)
+	if !ok {
+		return nil, false
+	}
+	provider, ok := providersByName[name]
+	if !ok {
+		tmpErr := clienterror.NewError(errors.Errorf("Unknown login provider '%s'", name), http.StatusNotFound)
+		rendering.RenderError(w, r, tmpErr, nil, http.StatusNotFound)
+		return nil, false
+	}
+	return provider, true
+}
@@ -0,0 +1,326 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/encryption"
+	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/token"
+	"github.com/francoishill/gomponents/user"
+)
+
+const (
+	testClientID     = "client-id"
+	testClientSecret = "client-secret"
+	testKid          = "key-1"
+)
+
+//stubIdP serves discovery, JWKS and the token endpoint of a provider, codes are registered by the test in place of
+//the authorization endpoint
+type stubIdP struct {
+	server     *httptest.Server
+	key        *rsa.PrivateKey
+	signingKey *rsa.PrivateKey
+
+	lock   sync.Mutex
+	codes  map[string]authRequest
+	claims func(claims jwt.MapClaims)
+}
+
+type authRequest struct {
+	codeChallenge string
+	nonce         string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	idp := &stubIdP{key: key, signingKey: key, codes: map[string]authRequest{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{{
+			Kid: testKid,
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.handleToken)
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+func (i *stubIdP) authorize(code string, request authRequest) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.codes[code] = request
+}
+
+func (i *stubIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(errorCode string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": errorCode})
+	}
+
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != testClientID || clientSecret != testClientSecret {
+		tokenError("invalid_client")
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError("invalid_request")
+		return
+	}
+
+	i.lock.Lock()
+	request, found := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	claimsFunc := i.claims
+	i.lock.Unlock()
+	if !found {
+		tokenError("invalid_grant")
+		return
+	}
+	verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(verifierHash[:]) != request.codeChallenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            i.server.URL,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"nonce":          request.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+	if claimsFunc != nil {
+		claimsFunc(claims)
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = testKid
+	signed, err := idToken.SignedString(i.signingKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": signed})
+}
+
+type testUser struct{ id, email string }
+
+func (u *testUser) ID() string               { return u.id }
+func (u *testUser) IsAdmin() bool            { return false }
+func (u *testUser) IsEmailVerified() bool    { return true }
+func (u *testUser) Status() user.Status      { return user.StatusActive }
+func (u *testUser) PasswordHash() string     { return "" }
+func (u *testUser) Email() string            { return u.email }
+func (u *testUser) MagicLoginToken() *string { return nil }
+
+type testMapper struct{}
+
+func (testMapper) LoadOrCreateUser(identity Identity) (auth.User, error) {
+	return &testUser{id: identity.Provider + ":" + identity.Subject, email: identity.Email}, nil
+}
+
+//testAuthService only implements the methods used by the router
+type testAuthService struct {
+	auth.Service
+}
+
+func (testAuthService) ExternalLogin(ctx context.Context, user auth.User) (token.Pair, error) {
+	return token.Pair{AccessToken: "access-" + user.ID()}, nil
+}
+
+func (testAuthService) IsMFARequiredErr(err error) (string, bool) { return "", false }
+
+type testResponses struct{}
+
+func (testResponses) LoggedIn(user auth.User, tokens token.Pair) LoggedInResponse {
+	return map[string]string{"user": user.ID(), "access_token": tokens.AccessToken}
+}
+
+func (testResponses) MFARequired(user auth.User, pendingToken string) MFARequiredResponse {
+	return map[string]string{"user": user.ID(), "pending_token": pendingToken}
+}
+
+//startLogin calls the login route and returns the state cookie and the authorization request parameters
+func startLogin(t *testing.T, app http.Handler) (*http.Cookie, url.Values) {
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stub/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected login redirect, got %d: %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != stateCookieName {
+		t.Fatalf("Expected the state cookie, got %v", cookies)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid redirect location: %s", err)
+	}
+	return cookies[0], location.Query()
+}
+
+func callback(app http.Handler, cookie *http.Cookie, code, state string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/stub/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	return w
+}
+
+func newTestApp(idp *stubIdP, config ProviderConfig) http.Handler {
+	config.Name = "stub"
+	config.IssuerURL = idp.server.URL
+	config.ClientID = testClientID
+	config.ClientSecret = testClientSecret
+	config.RedirectURL = "https://app.example.com/oidc/stub/callback"
+	provider := NewProvider(config, idp.server.Client())
+	cipher := encryption.AESCipher([]byte("0123456789abcdef0123456789abcdef"))
+	return Router(rendering.ChiService(), testAuthService{}, []*Provider{provider}, cipher, testMapper{}, testResponses{})
+}
+
+func TestCallback(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		//setup changes the stub and the authorization request before the callback
+		setup      func(idp *stubIdP, request *authRequest)
+		wantStatus int
+	}{
+		{
+			name:       "valid login",
+			setup:      func(idp *stubIdP, request *authRequest) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "PKCE verifier does not match the challenge",
+			setup: func(idp *stubIdP, request *authRequest) {
+				otherHash := sha256.Sum256([]byte("other verifier"))
+				request.codeChallenge = base64.RawURLEncoding.EncodeToString(otherHash[:])
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "nonce mismatch",
+			setup:      func(idp *stubIdP, request *authRequest) { request.nonce = "other nonce" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "issuer mismatch",
+			setup: func(idp *stubIdP, request *authRequest) {
+				idp.claims = func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "audience mismatch",
+			setup: func(idp *stubIdP, request *authRequest) {
+				idp.claims = func(claims jwt.MapClaims) { claims["aud"] = "other-client" }
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "expired ID token",
+			setup: func(idp *stubIdP, request *authRequest) {
+				idp.claims = func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "signed with a key that is not in the JWKS",
+			setup:      func(idp *stubIdP, request *authRequest) { idp.signingKey = otherKey },
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			defer idp.server.Close()
+			app := newTestApp(idp, ProviderConfig{})
+
+			cookie, params := startLogin(t, app)
+			if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" || params.Get("nonce") == "" {
+				t.Fatalf("Expected a PKCE challenge and nonce, got %v", params)
+			}
+			request := authRequest{codeChallenge: params.Get("code_challenge"), nonce: params.Get("nonce")}
+			test.setup(idp, &request)
+			idp.authorize("code-1", request)
+
+			w := callback(app, cookie, "code-1", params.Get("state"))
+			if w.Code != test.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", test.wantStatus, w.Code, w.Body.String())
+			}
+			if test.wantStatus == http.StatusOK && !strings.Contains(w.Body.String(), "access-stub:subject-1") {
+				t.Fatalf("Expected the tokens of the mapped user, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCallbackStateMismatch(t *testing.T) {
+	idp := newStubIdP(t)
+	defer idp.server.Close()
+	app := newTestApp(idp, ProviderConfig{})
+
+	cookie, params := startLogin(t, app)
+	idp.authorize("code-1", authRequest{codeChallenge: params.Get("code_challenge"), nonce: params.Get("nonce")})
+
+	w := callback(app, cookie, "code-1", "other state")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
+
+func TestStateCookieSecure(t *testing.T) {
+	idp := newStubIdP(t)
+	defer idp.server.Close()
+
+	//plain HTTP request, like behind a proxy that terminates TLS
+	cookie, _ := startLogin(t, newTestApp(idp, ProviderConfig{}))
+	if !cookie.Secure {
+		t.Fatalf("Expected the state cookie to be Secure by default")
+	}
+
+	cookie, _ = startLogin(t, newTestApp(idp, ProviderConfig{InsecureStateCookie: true}))
+	if cookie.Secure {
+		t.Fatalf("Expected the state cookie not to be Secure with InsecureStateCookie")
+	}
+}
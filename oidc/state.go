@@ -0,0 +1,93 @@
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/encryption"
+)
+
+//loginState is kept in an encrypted cookie between the redirect to the provider and the callback, so that no server
+//side storage is needed
+type loginState struct {
+	Provider     string    `json:"provider"`
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+const (
+	stateCookieName = "oidc_state"
+	stateTTL        = 10 * time.Minute
+)
+
+func newLoginState(provider string) (loginState, error) {
+	state, err := randomString(24)
+	if err != nil {
+		return loginState{}, err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return loginState{}, err
+	}
+	codeVerifier, err := randomString(48)
+	if err != nil {
+		return loginState{}, err
+	}
+
+	return loginState{
+		Provider:     provider,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(stateTTL),
+	}, nil
+}
+
+func setStateCookie(w http.ResponseWriter, cipher encryption.Cipher, state loginState, secure bool) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode login state")
+	}
+	value, err := cipher.Encrypt(string(b))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encrypt login state")
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  state.ExpiresAt,
+		HttpOnly: true,
+		Secure:   secure,
+		//Lax so the cookie is sent on the top-level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func popStateCookie(w http.ResponseWriter, r *http.Request, cipher encryption.Cipher) (loginState, error) {
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil {
+		return loginState{}, errors.New("Login state cookie is missing")
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookieName, Value: "", Path: "/", MaxAge: -1})
+
+	plaintext, err := cipher.Decrypt(cookie.Value)
+	if err != nil {
+		return loginState{}, errors.Wrapf(err, "Invalid login state cookie")
+	}
+	state := loginState{}
+	if err := json.Unmarshal([]byte(plaintext), &state); err != nil {
+		return loginState{}, errors.Wrapf(err, "Invalid login state cookie")
+	}
+	if time.Now().After(state.ExpiresAt) {
+		return loginState{}, errors.New("Login state expired")
+	}
+	return state, nil
+}
@@ -0,0 +1,84 @@
+package org
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/rendering"
+)
+
+type Middleware interface {
+	//RequireMembership requires an active membership with at least the minimum role of the organization in the
+	//"orgID" URL param, or else of the active organization (see auth.Middleware.GetContextOrgID). It must be used
+	//after auth.Middleware.LoadUser.
+	RequireMembership(minimum Role) func(http.Handler) http.Handler
+	//GetContextMembership returns the membership loaded by RequireMembership
+	GetContextMembership(ctx context.Context) Membership
+}
+
+//URLParamOrgID is the URL param RequireMembership checks before falling back to the active organization
+const URLParamOrgID = "orgID"
+
+func DefaultMiddleware(rendering rendering.Service, authMiddleware auth.Middleware, service Service) *defaultMiddleware {
+	type ctxKey struct{ name string }
+	return &defaultMiddleware{
+		rendering:        rendering,
+		authMiddleware:   authMiddleware,
+		service:          service,
+		membershipCtxKey: &ctxKey{"org-membership"},
+	}
+}
+
+type defaultMiddleware struct {
+	rendering      rendering.Service
+	authMiddleware auth.Middleware
+	service        Service
+
+	membershipCtxKey interface{}
+}
+
+func (m *defaultMiddleware) RequireMembership(minimum Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orgID := chi.URLParam(r, URLParamOrgID)
+			if orgID == "" {
+				orgID = m.authMiddleware.GetContextOrgID(r.Context())
+			}
+			if orgID == "" {
+				m.rendering.RenderError(w, r, errors.New("No organization selected"), nil, http.StatusBadRequest)
+				return
+			}
+
+			user := m.authMiddleware.GetContextUser(r.Context())
+			membership, err := m.service.Membership(orgID, user.ID())
+			if err != nil {
+				if clientErr, ok := err.(clienterror.Error); ok && clientErr.Status() == http.StatusNotFound {
+					m.rendering.RenderError(w, r, errors.New("Not a member of this organization"), nil, http.StatusForbidden)
+					return
+				}
+				m.rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			if !membership.IsActive() {
+				m.rendering.RenderError(w, r, errors.New("The organization invite has not been accepted yet"), nil, http.StatusForbidden)
+				return
+			}
+			if !membership.Role.AtLeast(minimum) {
+				m.rendering.RenderError(w, r, errors.Errorf("Organization role '%s' is required for this action", minimum), nil, http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), m.membershipCtxKey, membership)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (m *defaultMiddleware) GetContextMembership(ctx context.Context) Membership {
+	return ctx.Value(m.membershipCtxKey).(Membership)
+}
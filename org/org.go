@@ -0,0 +1,55 @@
+package org
+
+import "time"
+
+//Org is an organization (workspace) that users are members of
+type Org struct {
+	ID        string    `bson:"_id" json:"id"`
+	Name      string    `bson:"name" json:"name"`
+	CreatedBy string    `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+//Role is the role of a member within one organization, it is independent of user.IsAdmin
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+)
+
+var roleRanks = map[Role]int{
+	RoleMember: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+func (r Role) IsValid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+//AtLeast reports whether r grants everything minimum grants
+func (r Role) AtLeast(minimum Role) bool {
+	return roleRanks[r] >= roleRanks[minimum] && r.IsValid()
+}
+
+type MembershipStatus string
+
+const (
+	StatusInvited MembershipStatus = "invited"
+	StatusActive  MembershipStatus = "active"
+)
+
+//Membership links a user to an organization, invited members only get access after accepting
+type Membership struct {
+	OrgID     string           `bson:"org_id" json:"org_id"`
+	UserID    string           `bson:"user_id" json:"user_id"`
+	Role      Role             `bson:"role" json:"role"`
+	Status    MembershipStatus `bson:"status" json:"status"`
+	InvitedBy string           `bson:"invited_by,omitempty" json:"invited_by,omitempty"`
+	CreatedAt time.Time        `bson:"created_at" json:"created_at"`
+}
+
+func (m *Membership) IsActive() bool { return m.Status == StatusActive }
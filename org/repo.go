@@ -0,0 +1,23 @@
+package org
+
+type Repo interface {
+	IsErrNotFound(err error) bool
+	IsDupErr(err error) bool
+
+	AddOrg(org Org) error
+	GetOrg(id string) (Org, error)
+	//ListOrgs returns the organizations with the given ids
+	ListOrgs(ids []string) ([]Org, error)
+
+	//AddMembership must fail with a duplicate error if the user already has a membership of the organization
+	AddMembership(membership Membership) error
+	GetMembership(orgID, userID string) (Membership, error)
+	ListMembershipsOfOrg(orgID string) ([]Membership, error)
+	ListMembershipsOfUser(userID string) ([]Membership, error)
+	UpdateMembership(membership Membership) error
+	DeleteMembership(orgID, userID string) error
+}
+
+type RepoFactory interface {
+	Repo() Repo
+}
@@ -0,0 +1,26 @@
+package org
+
+import "github.com/francoishill/gomponents/user"
+
+type RequestFactory interface {
+	Create() CreateRequest
+	Invite() InviteRequest
+	ChangeRole() ChangeRoleRequest
+}
+
+type CreateRequest interface {
+	Validate() error
+	Name() string
+}
+
+type InviteRequest interface {
+	Validate() error
+	//LoadUser loads the invited user, for example by email
+	LoadUser() (user.User, error)
+	Role() Role
+}
+
+type ChangeRoleRequest interface {
+	Validate() error
+	Role() Role
+}
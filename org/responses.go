@@ -0,0 +1,16 @@
+package org
+
+import "github.com/francoishill/gomponents/token"
+
+type ResponseFactory interface {
+	Org(org Org, membership Membership) OrgResponse
+	Member(membership Membership) MemberResponse
+	//Switched contains the new tokens that carry the active organization
+	Switched(org Org, tokens token.Pair) SwitchedResponse
+	MemberRemoved(orgID, userID string) MemberRemovedResponse
+}
+
+type OrgResponse interface{}
+type MemberResponse interface{}
+type SwitchedResponse interface{}
+type MemberRemovedResponse interface{}
@@ -0,0 +1,226 @@
+package org
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
+)
+
+//Router lets users create organizations, switch their active organization and manage members. Org admins can invite
+//and manage members, only owners can grant the owner role or manage other owners. Members can remove themselves.
+func Router(
+	authService auth.Service,
+	authMiddleware auth.Middleware, orgMiddleware Middleware,
+	rendering rendering.Service,
+	service Service,
+	requestFactory RequestFactory, responseFactory ResponseFactory) *chi.Mux {
+
+	r := chi.NewRouter()
+
+	r.Use(authMiddleware.Authenticate()...)
+	r.Use(authMiddleware.LoadUser())
+
+	//canManage checks that the current member may give (or take away) role
+	canManage := func(w http.ResponseWriter, r *http.Request, role Role) bool {
+		current := orgMiddleware.GetContextMembership(r.Context())
+		if role == RoleOwner && current.Role != RoleOwner {
+			tmpErr := clienterror.NewError(errors.New("Only organization owners can manage owners"), http.StatusForbidden)
+			rendering.RenderError(w, r, tmpErr, nil, http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		user := authMiddleware.GetContextUser(r.Context())
+		orgs, memberships, err := service.ListForUser(user.ID())
+		if err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		responses := []OrgResponse{}
+		for i := range orgs {
+			responses = append(responses, responseFactory.Org(orgs[i], memberships[i]))
+		}
+		render.Respond(w, r, responses)
+	})
+
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.Create()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		user := authMiddleware.GetContextUser(r.Context())
+		org, membership, err := service.Create(body.Name(), user.ID())
+		if err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Status(r, http.StatusCreated)
+		render.Respond(w, r, responseFactory.Org(org, membership))
+	})
+
+	r.Route("/{"+URLParamOrgID+"}", func(r chi.Router) {
+		r.Post("/accept", func(w http.ResponseWriter, r *http.Request) {
+			orgID, ok := request.RequiredURLParam(w, r, URLParamOrgID, rendering)
+			if !ok {
+				return
+			}
+			org, err := service.Get(orgID)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+
+			user := authMiddleware.GetContextUser(r.Context())
+			membership, err := service.AcceptInvite(org.ID, user.ID())
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.Org(org, membership))
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(orgMiddleware.RequireMembership(RoleMember))
+
+			r.Post("/switch", func(w http.ResponseWriter, r *http.Request) {
+				membership := orgMiddleware.GetContextMembership(r.Context())
+				org, err := service.Get(membership.OrgID)
+				if err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+					return
+				}
+
+				user, ok := authMiddleware.GetContextUser(r.Context()).(auth.User)
+				if !ok {
+					rendering.RenderError(w, r, errors.New("User does not implement auth.User"), nil, http.StatusInternalServerError)
+					return
+				}
+				tokens, err := authService.SwitchOrg(request.ClientContext(r), user, org.ID)
+				if err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+					return
+				}
+				render.Respond(w, r, responseFactory.Switched(org, tokens))
+			})
+
+			r.Get("/members", func(w http.ResponseWriter, r *http.Request) {
+				membership := orgMiddleware.GetContextMembership(r.Context())
+				memberships, err := service.Members(membership.OrgID)
+				if err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+					return
+				}
+
+				responses := []MemberResponse{}
+				for _, m := range memberships {
+					responses = append(responses, responseFactory.Member(m))
+				}
+				render.Respond(w, r, responses)
+			})
+
+			r.Delete("/members/{userID}", func(w http.ResponseWriter, r *http.Request) {
+				userID, ok := request.RequiredURLParam(w, r, "userID", rendering)
+				if !ok {
+					return
+				}
+				current := orgMiddleware.GetContextMembership(r.Context())
+
+				if userID != current.UserID {
+					if !current.Role.AtLeast(RoleAdmin) {
+						tmpErr := clienterror.NewError(errors.Errorf("Organization role '%s' is required for this action", RoleAdmin), http.StatusForbidden)
+						rendering.RenderError(w, r, tmpErr, nil, http.StatusForbidden)
+						return
+					}
+					target, err := service.Membership(current.OrgID, userID)
+					if err != nil {
+						rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+						return
+					}
+					if !canManage(w, r, target.Role) {
+						return
+					}
+				}
+
+				if err := service.RemoveMember(current.OrgID, userID); err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+					return
+				}
+				render.Respond(w, r, responseFactory.MemberRemoved(current.OrgID, userID))
+			})
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(orgMiddleware.RequireMembership(RoleAdmin))
+
+			r.Post("/members", func(w http.ResponseWriter, r *http.Request) {
+				body := requestFactory.Invite()
+				if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+					return
+				}
+				if !canManage(w, r, body.Role()) {
+					return
+				}
+				invitedUser, err := body.LoadUser()
+				if err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+					return
+				}
+
+				current := orgMiddleware.GetContextMembership(r.Context())
+				membership, err := service.Invite(current.OrgID, invitedUser.ID(), body.Role(), current.UserID)
+				if err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+					return
+				}
+
+				render.Status(r, http.StatusCreated)
+				render.Respond(w, r, responseFactory.Member(membership))
+			})
+
+			r.Patch("/members/{userID}", func(w http.ResponseWriter, r *http.Request) {
+				userID, ok := request.RequiredURLParam(w, r, "userID", rendering)
+				if !ok {
+					return
+				}
+				body := requestFactory.ChangeRole()
+				if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+					return
+				}
+
+				current := orgMiddleware.GetContextMembership(r.Context())
+				target, err := service.Membership(current.OrgID, userID)
+				if err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+					return
+				}
+				if !canManage(w, r, target.Role) || !canManage(w, r, body.Role()) {
+					return
+				}
+
+				membership, err := service.ChangeRole(current.OrgID, userID, body.Role())
+				if err != nil {
+					rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+					return
+				}
+				render.Respond(w, r, responseFactory.Member(membership))
+			})
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,247 @@
+package org
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/encryption"
+)
+
+type Service interface {
+	//Create adds the organization with the creator as its owner
+	Create(name string, creatorUserID string) (Org, Membership, error)
+	Get(orgID string) (Org, error)
+	//ListForUser returns the organizations the user is an active member of, along with the memberships
+	ListForUser(userID string) ([]Org, []Membership, error)
+
+	//Membership returns a not found client error if the user has no membership of the organization
+	Membership(orgID, userID string) (Membership, error)
+	Members(orgID string) ([]Membership, error)
+	Invite(orgID, userID string, role Role, invitedBy string) (Membership, error)
+	AcceptInvite(orgID, userID string) (Membership, error)
+	ChangeRole(orgID, userID string, role Role) (Membership, error)
+	//RemoveMember also removes pending invites, the last owner cannot be removed
+	RemoveMember(orgID, userID string) error
+}
+
+const idByteLength = 12
+
+func DefaultService(repoFactory RepoFactory, encryption encryption.Service) *defaultService {
+	return &defaultService{
+		repoFactory,
+		encryption,
+	}
+}
+
+type defaultService struct {
+	repoFactory RepoFactory
+	encryption  encryption.Service
+}
+
+func (s *defaultService) Create(name string, creatorUserID string) (Org, Membership, error) {
+	id, err := s.encryption.NewSecureToken(idByteLength)
+	if err != nil {
+		return Org{}, Membership{}, errors.Wrapf(err, "Failed to generate organization id")
+	}
+
+	now := time.Now()
+	org := Org{
+		ID:        id,
+		Name:      name,
+		CreatedBy: creatorUserID,
+		CreatedAt: now,
+	}
+	membership := Membership{
+		OrgID:     id,
+		UserID:    creatorUserID,
+		Role:      RoleOwner,
+		Status:    StatusActive,
+		CreatedAt: now,
+	}
+
+	repo := s.repoFactory.Repo()
+	if err := repo.AddOrg(org); err != nil {
+		return Org{}, Membership{}, errors.Wrapf(err, "Failed to add organization")
+	}
+	if err := repo.AddMembership(membership); err != nil {
+		return Org{}, Membership{}, errors.Wrapf(err, "Failed to add organization owner")
+	}
+
+	logrus.WithField("org-id", id).WithField("user-id", creatorUserID).Info("Created organization")
+	return org, membership, nil
+}
+
+func (s *defaultService) Get(orgID string) (Org, error) {
+	repo := s.repoFactory.Repo()
+	org, err := repo.GetOrg(orgID)
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return Org{}, clienterror.NewError(errors.Errorf("Organization '%s' not found", orgID), http.StatusNotFound)
+		}
+		return Org{}, errors.Wrapf(err, "Failed to get organization")
+	}
+	return org, nil
+}
+
+func (s *defaultService) ListForUser(userID string) ([]Org, []Membership, error) {
+	repo := s.repoFactory.Repo()
+	allMemberships, err := repo.ListMembershipsOfUser(userID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to list memberships")
+	}
+
+	memberships := []Membership{}
+	membershipsByOrg := map[string]Membership{}
+	orgIDs := []string{}
+	for _, m := range allMemberships {
+		if m.IsActive() {
+			membershipsByOrg[m.OrgID] = m
+			orgIDs = append(orgIDs, m.OrgID)
+		}
+	}
+
+	orgs := []Org{}
+	if len(orgIDs) == 0 {
+		return orgs, memberships, nil
+	}
+	foundOrgs, err := repo.ListOrgs(orgIDs)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to list organizations")
+	}
+	//keep orgs and memberships aligned, ignoring memberships of deleted organizations
+	for _, org := range foundOrgs {
+		if m, ok := membershipsByOrg[org.ID]; ok {
+			orgs = append(orgs, org)
+			memberships = append(memberships, m)
+		}
+	}
+	return orgs, memberships, nil
+}
+
+func (s *defaultService) Membership(orgID, userID string) (Membership, error) {
+	repo := s.repoFactory.Repo()
+	membership, err := repo.GetMembership(orgID, userID)
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return Membership{}, clienterror.NewError(errors.Errorf("User '%s' is not a member of organization '%s'", userID, orgID), http.StatusNotFound)
+		}
+		return Membership{}, errors.Wrapf(err, "Failed to get membership")
+	}
+	return membership, nil
+}
+
+func (s *defaultService) Members(orgID string) ([]Membership, error) {
+	memberships, err := s.repoFactory.Repo().ListMembershipsOfOrg(orgID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list organization members")
+	}
+	return memberships, nil
+}
+
+func (s *defaultService) Invite(orgID, userID string, role Role, invitedBy string) (Membership, error) {
+	if !role.IsValid() {
+		return Membership{}, clienterror.NewError(errors.Errorf("Unknown organization role '%s'", role), http.StatusBadRequest)
+	}
+
+	membership := Membership{
+		OrgID:     orgID,
+		UserID:    userID,
+		Role:      role,
+		Status:    StatusInvited,
+		InvitedBy: invitedBy,
+		CreatedAt: time.Now(),
+	}
+
+	repo := s.repoFactory.Repo()
+	if err := repo.AddMembership(membership); err != nil {
+		if repo.IsDupErr(err) {
+			return Membership{}, clienterror.NewError(errors.New("User is already a member or invited"), http.StatusConflict)
+		}
+		return Membership{}, errors.Wrapf(err, "Failed to add membership")
+	}
+
+	logrus.WithField("org-id", orgID).WithField("user-id", userID).WithField("role", role).Info("Invited organization member")
+	return membership, nil
+}
+
+func (s *defaultService) AcceptInvite(orgID, userID string) (Membership, error) {
+	membership, err := s.Membership(orgID, userID)
+	if err != nil {
+		return Membership{}, err
+	}
+	if membership.IsActive() {
+		return membership, nil
+	}
+
+	membership.Status = StatusActive
+	if err := s.repoFactory.Repo().UpdateMembership(membership); err != nil {
+		return Membership{}, errors.Wrapf(err, "Failed to accept invite")
+	}
+
+	logrus.WithField("org-id", orgID).WithField("user-id", userID).Info("Accepted organization invite")
+	return membership, nil
+}
+
+func (s *defaultService) ChangeRole(orgID, userID string, role Role) (Membership, error) {
+	if !role.IsValid() {
+		return Membership{}, clienterror.NewError(errors.Errorf("Unknown organization role '%s'", role), http.StatusBadRequest)
+	}
+
+	membership, err := s.Membership(orgID, userID)
+	if err != nil {
+		return Membership{}, err
+	}
+	if membership.Role == RoleOwner && role != RoleOwner {
+		if err := s.checkNotLastOwner(orgID); err != nil {
+			return Membership{}, err
+		}
+	}
+
+	membership.Role = role
+	if err := s.repoFactory.Repo().UpdateMembership(membership); err != nil {
+		return Membership{}, errors.Wrapf(err, "Failed to change role")
+	}
+
+	logrus.WithField("org-id", orgID).WithField("user-id", userID).WithField("role", role).Info("Changed organization role")
+	return membership, nil
+}
+
+func (s *defaultService) RemoveMember(orgID, userID string) error {
+	membership, err := s.Membership(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if membership.Role == RoleOwner && membership.IsActive() {
+		if err := s.checkNotLastOwner(orgID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repoFactory.Repo().DeleteMembership(orgID, userID); err != nil {
+		return errors.Wrapf(err, "Failed to remove member")
+	}
+
+	logrus.WithField("org-id", orgID).WithField("user-id", userID).Info("Removed organization member")
+	return nil
+}
+
+func (s *defaultService) checkNotLastOwner(orgID string) error {
+	memberships, err := s.Members(orgID)
+	if err != nil {
+		return err
+	}
+	owners := 0
+	for _, m := range memberships {
+		if m.Role == RoleOwner && m.IsActive() {
+			owners++
+		}
+	}
+	if owners <= 1 {
+		return clienterror.NewError(errors.New("An organization needs at least one owner"), http.StatusConflict)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package passwordpolicy
+
+//MaxPasswordLength is enforced even when Policy.MaxLength is zero or larger, passwords are checked before the user is
+//authenticated
+const MaxPasswordLength = 1024
+
+//Policy configures the rules, zero values disable a rule
+type Policy struct {
+	MinLength int
+	//MaxLength is at most MaxPasswordLength
+	MaxLength int
+
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	//MinCharacterClasses requires this many of the lower, upper, digit and symbol classes
+	MinCharacterClasses int
+
+	//MinStrength is the minimum Strength.Score (0-4)
+	MinStrength int
+
+	RejectCommon         bool
+	RejectUserAttributes bool
+}
+
+//DefaultPolicy follows the NIST 800-63B guidance: length and strength matter, character class rules are off
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:            10,
+		MaxLength:            128,
+		MinStrength:          2,
+		RejectCommon:         true,
+		RejectUserAttributes: true,
+	}
+}
+
+type ViolationCode string
+
+const (
+	CodeTooShort              ViolationCode = "too_short"
+	CodeTooLong               ViolationCode = "too_long"
+	CodeMissingLower          ViolationCode = "missing_lowercase"
+	CodeMissingUpper          ViolationCode = "missing_uppercase"
+	CodeMissingDigit          ViolationCode = "missing_digit"
+	CodeMissingSymbol         ViolationCode = "missing_symbol"
+	CodeTooFewClasses         ViolationCode = "too_few_character_classes"
+	CodeTooWeak               ViolationCode = "too_weak"
+	CodeCommon                ViolationCode = "common_password"
+	CodeContainsUserAttribute ViolationCode = "contains_user_attribute"
+	CodeBreached              ViolationCode = "breached"
+)
+
+//Violation is a broken rule, Limit is the configured minimum or maximum for the rules that have one
+type Violation struct {
+	Code    ViolationCode `json:"code"`
+	Message string        `json:"message"`
+	Limit   int           `json:"limit,omitempty"`
+}
@@ -0,0 +1,185 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/user"
+)
+
+//Service checks passwords against the policy, it implements auth.PasswordPolicy
+type Service interface {
+	//Check returns all violations, user may be nil (like before registration completed)
+	Check(password string, user user.User) []Violation
+	//Validate returns a 400 clienterror.DetailedError with the violations as details
+	Validate(password string, user user.User) error
+}
+
+//BreachChecker tells how often a password was seen in breach corpora, see the breach package
+type BreachChecker interface {
+	Count(password string) (int, error)
+}
+
+//AttributesFunc returns the user values a password may not contain, like the email and names
+type AttributesFunc func(user user.User) []string
+
+func DefaultService(policy Policy, attributesFunc AttributesFunc) *defaultService {
+	return &defaultService{
+		policy:         policy,
+		attributesFunc: attributesFunc,
+	}
+}
+
+type defaultService struct {
+	policy         Policy
+	attributesFunc AttributesFunc
+
+	breachChecker  BreachChecker
+	breachMinCount int
+}
+
+//WithBreachChecker rejects passwords seen at least minCount times in breaches. The check fails open: when the
+//checker errors the password is not rejected for it.
+func (s *defaultService) WithBreachChecker(checker BreachChecker, minCount int) *defaultService {
+	s.breachChecker = checker
+	s.breachMinCount = minCount
+	if s.breachMinCount < 1 {
+		s.breachMinCount = 1
+	}
+	return s
+}
+
+func (s *defaultService) Check(password string, u user.User) []Violation {
+	violations := []Violation{}
+	p := s.policy
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, Violation{CodeTooShort, fmt.Sprintf("Password must have at least %d characters", p.MinLength), p.MinLength})
+	}
+	maxLength := p.MaxLength
+	if maxLength <= 0 || maxLength > MaxPasswordLength {
+		maxLength = MaxPasswordLength
+	}
+	if length > maxLength {
+		violations = append(violations, Violation{CodeTooLong, fmt.Sprintf("Password may have at most %d characters", maxLength), maxLength})
+		//the other checks are quadratic in the length
+		return violations
+	}
+
+	violations = append(violations, s.checkClasses(password)...)
+
+	attributes := []string{}
+	if u != nil && s.attributesFunc != nil {
+		attributes = attributeTokens(s.attributesFunc(u))
+	}
+
+	if p.RejectCommon && isCommon(password) {
+		violations = append(violations, Violation{Code: CodeCommon, Message: "Password is too common"})
+	}
+	if p.RejectUserAttributes {
+		lowerPassword := strings.ToLower(password)
+		for _, attribute := range attributes {
+			if strings.Contains(lowerPassword, attribute) {
+				violations = append(violations, Violation{Code: CodeContainsUserAttribute, Message: "Password may not contain your personal details"})
+				break
+			}
+		}
+	}
+	if s.breachChecker != nil {
+		count, err := s.breachChecker.Count(password)
+		if err != nil {
+			logrus.WithError(err).Error("Unable to check password against breaches")
+		} else if count >= s.breachMinCount {
+			violations = append(violations, Violation{Code: CodeBreached, Message: "Password appeared in a data breach, choose a different one"})
+		}
+	}
+	if p.MinStrength > 0 {
+		if strength := EstimateStrength(password, attributes...); strength.Score < p.MinStrength {
+			violations = append(violations, Violation{CodeTooWeak, "Password is too easy to guess", p.MinStrength})
+		}
+	}
+
+	return violations
+}
+
+func (s *defaultService) checkClasses(password string) []Violation {
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+
+	violations := []Violation{}
+	p := s.policy
+	if p.RequireLower && !hasLower {
+		violations = append(violations, Violation{Code: CodeMissingLower, Message: "Password must contain a lowercase letter"})
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, Violation{Code: CodeMissingUpper, Message: "Password must contain an uppercase letter"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, Violation{Code: CodeMissingDigit, Message: "Password must contain a digit"})
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, Violation{Code: CodeMissingSymbol, Message: "Password must contain a symbol"})
+	}
+
+	classes := 0
+	for _, has := range []bool{hasLower, hasUpper, hasDigit, hasSymbol} {
+		if has {
+			classes++
+		}
+	}
+	if p.MinCharacterClasses > 0 && classes < p.MinCharacterClasses {
+		message := fmt.Sprintf("Password must contain %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharacterClasses)
+		violations = append(violations, Violation{CodeTooFewClasses, message, p.MinCharacterClasses})
+	}
+	return violations
+}
+
+func (s *defaultService) Validate(password string, u user.User) error {
+	violations := s.Check(password, u)
+	if len(violations) == 0 {
+		return nil
+	}
+	return clienterror.NewErrorWithDetails(errors.New("Password does not meet the password policy"), http.StatusBadRequest, violations)
+}
+
+//attributeTokens splits attributes (like "jane.doe@example.com") into lowercase parts of at least 3 characters,
+//like "jane.doe", "jane" and "doe"
+func attributeTokens(attributes []string) []string {
+	tokens := []string{}
+	for _, attribute := range attributes {
+		attribute = strings.ToLower(strings.TrimSpace(attribute))
+		if attribute == "" {
+			continue
+		}
+		//the email domain is shared by many users, only its local part is personal
+		attribute = strings.SplitN(attribute, "@", 2)[0]
+		if utf8.RuneCountInString(attribute) >= 3 {
+			tokens = append(tokens, attribute)
+		}
+		for _, part := range strings.FieldsFunc(attribute, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			if utf8.RuneCountInString(part) >= 3 {
+				tokens = append(tokens, part)
+			}
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,327 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+//Strength is a zxcvbn-style estimate: the password is split into the cheapest sequence of guessable patterns
+//(common passwords, user inputs, keyboard walks, sequences, repeats and years), the rest is brute forced.
+type Strength struct {
+	//Score is 0 (too guessable) to 4 (very unguessable), the same scale as zxcvbn
+	Score int `json:"score"`
+	//GuessesLog10 is the estimated number of guesses as a power of 10
+	GuessesLog10 float64 `json:"guesses_log10"`
+}
+
+const (
+	bruteforceCardinality = 10
+	minSingleCharGuesses  = 10
+	minMultiCharGuesses   = 50
+	yearSpace             = 119
+
+	//maxEstimateLength limits the pattern matching, which is quadratic in the length, characters after it count as
+	//brute forced
+	maxEstimateLength = 100
+)
+
+var scoreThresholds = []float64{3, 6, 8, 10}
+
+//keyboardRows are matched forwards and backwards as keyboard walks
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+	"qazwsxedcrfvtgbyhnujmikolp",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p",
+}
+
+var leetSubstitutions = map[rune][]rune{
+	'4': {'a'},
+	'@': {'a'},
+	'8': {'b'},
+	'(': {'c'},
+	'3': {'e'},
+	'6': {'g'},
+	'1': {'i', 'l'},
+	'!': {'i'},
+	'|': {'i', 'l'},
+	'0': {'o'},
+	'$': {'s'},
+	'5': {'s'},
+	'7': {'t'},
+	'+': {'t'},
+	'2': {'z'},
+}
+
+//match covers password[start:end] and would be found after guesses
+type match struct {
+	start, end   int
+	guessesLog10 float64
+}
+
+//EstimateStrength treats userInputs (like the email and names) as the most likely dictionary words
+func EstimateStrength(password string, userInputs ...string) Strength {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Strength{}
+	}
+	extra := 0
+	if len(runes) > maxEstimateLength {
+		extra = len(runes) - maxEstimateLength
+		runes = runes[:maxEstimateLength]
+		password = string(runes)
+	}
+	n := len(runes)
+
+	lower := []rune(strings.ToLower(password))
+	userRanks := map[string]int{}
+	for i, input := range userInputs {
+		userRanks[strings.ToLower(input)] = i + 1
+	}
+
+	matches := dictionaryMatches(runes, lower, userRanks)
+	matches = append(matches, keyboardMatches(lower)...)
+	matches = append(matches, sequenceMatches(lower)...)
+	matches = append(matches, repeatMatches(lower)...)
+	matches = append(matches, yearMatches(lower)...)
+
+	matchesByStart := make([][]match, n)
+	for _, m := range matches {
+		matchesByStart[m.start] = append(matchesByStart[m.start], m)
+	}
+
+	//best[i] is the cheapest way (in log10 guesses) to guess the first i characters
+	best := make([]float64, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(1)
+	}
+	for i := 0; i < n; i++ {
+		if bruteforce := best[i] + math.Log10(bruteforceCardinality); bruteforce < best[i+1] {
+			best[i+1] = bruteforce
+		}
+		for _, m := range matchesByStart[i] {
+			if best[i]+m.guessesLog10 < best[m.end] {
+				best[m.end] = best[i] + m.guessesLog10
+			}
+		}
+	}
+
+	guessesLog10 := best[n] + float64(extra)*math.Log10(bruteforceCardinality)
+	score := 0
+	for _, threshold := range scoreThresholds {
+		if guessesLog10 >= threshold {
+			score++
+		}
+	}
+	return Strength{Score: score, GuessesLog10: guessesLog10}
+}
+
+func minGuessesLog10(guesses float64, length int) float64 {
+	minimum := float64(minMultiCharGuesses)
+	if length == 1 {
+		minimum = minSingleCharGuesses
+	}
+	return math.Log10(math.Max(guesses, minimum))
+}
+
+func dictionaryMatches(runes, lower []rune, userRanks map[string]int) []match {
+	matches := []match{}
+	rank := func(word string) int {
+		if r, ok := userRanks[word]; ok {
+			return r
+		}
+		return commonRanks[word]
+	}
+
+	//no word can match beyond the longest one
+	maxWordLength := maxCommonLength
+	for word := range userRanks {
+		if length := utf8.RuneCountInString(word); length > maxWordLength {
+			maxWordLength = length
+		}
+	}
+
+	for i := 0; i < len(lower); i++ {
+		for j := i + 3; j <= len(lower) && j-i <= maxWordLength; j++ {
+			word := string(lower[i:j])
+			reversed := reverse(lower[i:j])
+			variations := uppercaseVariations(runes[i:j])
+
+			candidates := []struct {
+				word       string
+				multiplier float64
+			}{{word, 1}, {reversed, 2}}
+			for _, leetWord := range unleet(lower[i:j]) {
+				candidates = append(candidates, struct {
+					word       string
+					multiplier float64
+				}{leetWord, 2})
+			}
+
+			for _, c := range candidates {
+				if r := rank(c.word); r > 0 {
+					guesses := float64(r) * c.multiplier * variations
+					matches = append(matches, match{i, j, minGuessesLog10(guesses, j-i)})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+//uppercaseVariations is 1 for all lowercase, 2 for a capitalized or all uppercase word and more for mixed case
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if strings.ToUpper(string(r)) == string(r) && strings.ToLower(string(r)) != string(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(word), upper == 1 && strings.ToUpper(string(word[0])) == string(word[0]):
+		return 2
+	}
+	return math.Pow(2, float64(upper))
+}
+
+//unleet returns the word with the leet substitutions undone, empty if there are none
+func unleet(word []rune) []string {
+	variants := [][]rune{{}}
+	substituted := false
+	for _, r := range word {
+		subs, ok := leetSubstitutions[r]
+		if !ok {
+			for i := range variants {
+				variants[i] = append(variants[i], r)
+			}
+			continue
+		}
+		substituted = true
+		next := [][]rune{}
+		for _, v := range variants {
+			for _, sub := range subs {
+				next = append(next, append(append([]rune{}, v...), sub))
+			}
+		}
+		//avoid blowing up on passwords full of ambiguous substitutions
+		if len(next) > 16 {
+			next = next[:16]
+		}
+		variants = next
+	}
+	if !substituted {
+		return nil
+	}
+
+	words := []string{}
+	for _, v := range variants {
+		words = append(words, string(v))
+	}
+	return words
+}
+
+func keyboardMatches(lower []rune) []match {
+	matches := []match{}
+	for _, row := range keyboardRows {
+		for _, walk := range []string{row, reverse([]rune(row))} {
+			for i := 0; i < len(lower); i++ {
+				j := i
+				for j < len(lower) && strings.ContainsRune(walk, lower[j]) &&
+					(j == i || strings.Index(walk, string(lower[j-1:j+1])) >= 0) {
+					j++
+				}
+				if j-i >= 3 {
+					//a start key on the row and the length, like zxcvbn's spatial guesses for a straight walk
+					guesses := float64(len(walk)) * float64(j-i) * 4
+					matches = append(matches, match{i, j, minGuessesLog10(guesses, j-i)})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+//sequenceMatches finds runs like "abcd", "9876" and "aceg" (a constant step)
+func sequenceMatches(lower []rune) []match {
+	matches := []match{}
+	for i := 0; i+2 < len(lower); {
+		step := lower[i+1] - lower[i]
+		j := i + 1
+		for j < len(lower) && lower[j]-lower[j-1] == step && step != 0 && step >= -5 && step <= 5 {
+			j++
+		}
+		if j-i >= 3 {
+			base := 26.0
+			if lower[i] >= '0' && lower[i] <= '9' {
+				base = 10
+			}
+			if lower[i] == 'a' || lower[i] == '1' || lower[i] == 'z' || lower[i] == '9' {
+				base = 4
+			}
+			if step < 0 {
+				base *= 2
+			}
+			matches = append(matches, match{i, j, minGuessesLog10(base*float64(j-i), j-i)})
+			i = j - 1
+			continue
+		}
+		i++
+	}
+	return matches
+}
+
+//repeatMatches finds a repeated unit like "aaaa" or "abcabc"
+func repeatMatches(lower []rune) []match {
+	matches := []match{}
+	for i := 0; i < len(lower); i++ {
+		for unit := 1; i+2*unit <= len(lower) && unit <= 8; unit++ {
+			j := i + unit
+			for j+unit <= len(lower) && string(lower[j:j+unit]) == string(lower[i:i+unit]) {
+				j += unit
+			}
+			if count := (j - i) / unit; count >= 2 && j-i >= 3 {
+				//a common unit or a brute forced one, zxcvbn estimates the unit recursively but that is too slow here
+				unitGuesses := float64(unit) * math.Log10(bruteforceCardinality)
+				if r := commonRanks[string(lower[i:i+unit])]; r > 0 {
+					unitGuesses = math.Min(unitGuesses, minGuessesLog10(float64(r), unit))
+				}
+				guessesLog10 := unitGuesses + math.Log10(float64(count))
+				matches = append(matches, match{i, j, math.Max(guessesLog10, math.Log10(minMultiCharGuesses))})
+			}
+		}
+	}
+	return matches
+}
+
+func yearMatches(lower []rune) []match {
+	matches := []match{}
+	for i := 0; i+4 <= len(lower); i++ {
+		year := string(lower[i : i+4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && isDigits(year) {
+			matches = append(matches, match{i, i + 4, math.Log10(yearSpace)})
+		}
+	}
+	return matches
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(runes []rune) string {
+	reversed := make([]rune, len(runes))
+	for i, r := range runes {
+		reversed[len(runes)-1-i] = r
+	}
+	return string(reversed)
+}
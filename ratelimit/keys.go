@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//KeyFunc returns the key a request is counted under, requests with an empty key are not limited
+type KeyFunc func(r *http.Request) (string, error)
+
+//KeyByIP uses the client IP, use chi's middleware.RealIP in front when running behind a proxy
+func KeyByIP(r *http.Request) (string, error) {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host, nil
+	}
+	return r.RemoteAddr, nil
+}
+
+func KeyByRoute(r *http.Request) (string, error) {
+	return r.Method + " " + r.URL.Path, nil
+}
+
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		return strings.TrimSpace(r.Header.Get(name)), nil
+	}
+}
+
+//MaxJSONFieldBodySize is the largest body KeyByJSONField reads
+const MaxJSONFieldBodySize = 64 << 10
+
+var errBodyTooLarge = errors.Errorf("Request body is larger than %d bytes", MaxJSONFieldBodySize)
+
+//KeyByJSONField uses a top-level string field of the JSON body (like the email of a login), the body is restored
+//for the next handler. Larger bodies than MaxJSONFieldBodySize are not keyed, the next handler then gets an error
+//after that size so that padding the body does not avoid the limit.
+func KeyByJSONField(field string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		if r.Body == nil {
+			return "", nil
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxJSONFieldBodySize+1))
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to read body")
+		}
+		r.Body.Close()
+		if len(body) > MaxJSONFieldBodySize {
+			r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body[:MaxJSONFieldBodySize]), errorReader{errBodyTooLarge}))
+			return "", nil
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			//let the handler report the invalid body
+			return "", nil
+		}
+		value, _ := fields[field].(string)
+		return strings.ToLower(strings.TrimSpace(value)), nil
+	}
+}
+
+type errorReader struct{ err error }
+
+func (r errorReader) Read(p []byte) (int, error) { return 0, r.err }
+
+//KeyByAll combines keys, like KeyByAll(KeyByIP, KeyByRoute) to limit each IP per route. The combined key is empty
+//if any of the keys is empty.
+func KeyByAll(keyFuncs ...KeyFunc) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		parts := []string{}
+		for _, keyFunc := range keyFuncs {
+			part, err := keyFunc(r)
+			if err != nil {
+				return "", err
+			}
+			if part == "" {
+				return "", nil
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, "|"), nil
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/rendering"
+)
+
+//Rule allows Limit requests per Window for every key returned by Key
+type Rule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    KeyFunc
+}
+
+//Middleware sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers and renders a 429 (with
+//Retry-After) once the limit is reached. If the store fails the request is let through.
+func Middleware(rendering rendering.Service, store Store, rule Rule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := logrus.WithField("rate-limit", rule.Name)
+
+			key, err := rule.Key(r)
+			if err != nil {
+				logger.WithError(err).Error("Failed to get rate limit key")
+				next.ServeHTTP(w, r)
+				return
+			}
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := store.Take(rule.Name+":"+key, rule.Limit, rule.Window)
+			if err != nil {
+				logger.WithError(err).Error("Failed to count request for rate limit")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			resetSeconds := int(math.Ceil(time.Until(result.Reset).Seconds()))
+			if resetSeconds < 0 {
+				resetSeconds = 0
+			}
+			w.Header().Set("RateLimit-Limit", fmt.Sprintf("%d", result.Limit))
+			w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d", result.Remaining))
+			w.Header().Set("RateLimit-Reset", fmt.Sprintf("%d", resetSeconds))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", resetSeconds))
+				tmpErr := errors.Errorf("Rate limit exceeded, try again in %d seconds", resetSeconds)
+				rendering.RenderError(w, r, clienterror.NewError(tmpErr, http.StatusTooManyRequests), map[string]interface{}{"rate-limit-key": key}, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/francoishill/gomponents/mongo"
+)
+
+//Result of counting a request against a limit
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	//Reset is when the request would be allowed again (if not Allowed), or when the count drops again
+	Reset time.Time
+}
+
+//Store counts requests with a sliding window, the count of the previous fixed window is weighted by how much of it
+//still overlaps the sliding window
+type Store interface {
+	Take(key string, limit int, window time.Duration) (Result, error)
+}
+
+func slidingResult(previous, current, limit int, window time.Duration, windowStart, now time.Time) Result {
+	elapsed := now.Sub(windowStart)
+	weight := float64(window-elapsed) / float64(window)
+	count := int(float64(previous)*weight) + current
+
+	result := Result{
+		Allowed:   count <= limit,
+		Limit:     limit,
+		Remaining: limit - count,
+		Reset:     windowStart.Add(window),
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	return result
+}
+
+//MemoryStore is only suitable for a single instance
+func MemoryStore() *memoryStore {
+	return &memoryStore{windows: map[string]*memoryWindow{}}
+}
+
+type memoryWindow struct {
+	start time.Time
+	//window is of the rule that counts the key, rules with different windows can share the store
+	window   time.Duration
+	previous int
+	current  int
+}
+
+type memoryStore struct {
+	lock      sync.Mutex
+	windows   map[string]*memoryWindow
+	lastPurge time.Time
+}
+
+func (s *memoryStore) Take(key string, limit int, window time.Duration) (Result, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	windowStart := now.Truncate(window)
+	s.purge(now, window)
+
+	w, ok := s.windows[key]
+	switch {
+	case !ok || windowStart.Sub(w.start) > window:
+		w = &memoryWindow{start: windowStart, window: window}
+		s.windows[key] = w
+	case windowStart.After(w.start):
+		w.previous, w.current, w.start, w.window = w.current, 0, windowStart, window
+	}
+
+	result := slidingResult(w.previous, w.current+1, limit, window, windowStart, now)
+	if result.Allowed {
+		w.current++
+	}
+	return result, nil
+}
+
+//purge drops the windows of every rule that are too old to be weighted in, window only decides how often it runs
+func (s *memoryStore) purge(now time.Time, window time.Duration) {
+	if now.Sub(s.lastPurge) < window {
+		return
+	}
+	s.lastPurge = now
+	for key, w := range s.windows {
+		if now.Sub(w.start) > 2*w.window {
+			delete(s.windows, key)
+		}
+	}
+}
+
+//MongoStore shares counts between instances, one document per key and fixed window removed by a TTL index
+func MongoStore(m mongo.Mongo) *mongoStore {
+	s := &mongoStore{m}
+	indexes := []mgo.Index{{Key: []string{"expires_at"}, ExpireAfter: time.Second}}
+	if err := m.EnsureIndexes(s.collection(), indexes); err != nil {
+		logrus.Panicf("Failed to ensure rate limit indexes, error: %s", err.Error())
+	}
+	return s
+}
+
+type mongoStore struct {
+	m mongo.Mongo
+}
+
+type mongoWindow struct {
+	Count int `bson:"count"`
+}
+
+func (s *mongoStore) collection() *mgo.Collection { return s.m.Collection("rate_limits") }
+
+func windowID(key string, windowStart time.Time) string {
+	return key + "@" + windowStart.UTC().Format(time.RFC3339)
+}
+
+func (s *mongoStore) Take(key string, limit int, window time.Duration) (Result, error) {
+	now := time.Now()
+	windowStart := now.Truncate(window)
+
+	var previous mongoWindow
+	if err := s.collection().FindId(windowID(key, windowStart.Add(-window))).One(&previous); err != nil && !s.m.IsErrNotFound(err) {
+		return Result{}, s.m.RefreshIfConnectionError(err)
+	}
+
+	var current mongoWindow
+	change := mgo.Change{
+		Update: bson.M{
+			"$inc": bson.M{"count": 1},
+			"$set": bson.M{"expires_at": windowStart.Add(2 * window)},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+	if _, err := s.collection().FindId(windowID(key, windowStart)).Apply(change, &current); err != nil {
+		return Result{}, s.m.RefreshIfConnectionError(err)
+	}
+
+	//unlike the memory store denied requests are counted too, which keeps this a single atomic update
+	return slidingResult(previous.Count, current.Count, limit, window, windowStart, now), nil
+}
@@ -0,0 +1,51 @@
+package rbac
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/rendering"
+)
+
+type Middleware interface {
+	//RequirePermission requires all of the permissions, it must be used after auth.Middleware.LoadUser
+	RequirePermission(permissions ...string) func(http.Handler) http.Handler
+}
+
+func DefaultMiddleware(rendering rendering.Service, authMiddleware auth.Middleware, service Service) *defaultMiddleware {
+	return &defaultMiddleware{
+		rendering,
+		authMiddleware,
+		service,
+	}
+}
+
+type defaultMiddleware struct {
+	rendering      rendering.Service
+	authMiddleware auth.Middleware
+	service        Service
+}
+
+func (m *defaultMiddleware) RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := m.authMiddleware.GetContextUser(r.Context())
+
+			allowed, err := m.service.HasPermissions(user, permissions...)
+			if err != nil {
+				m.rendering.RenderError(w, r, errors.Wrapf(err, "Failed to check permissions"), nil, http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				tmpErr := errors.Errorf("Permission %s is required for this action", strings.Join(permissions, ", "))
+				m.rendering.RenderError(w, r, tmpErr, nil, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package rbac
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+//AllPermissions grants every permission
+const AllPermissions = "*"
+
+//Role grants its own Permissions and those of the roles it Inherits
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	Inherits    []string `json:"inherits,omitempty"`
+}
+
+//Registry holds the roles known to the app, roles are defined in code and only assigned at runtime
+type Registry struct {
+	roles       map[string]Role
+	permissions map[string]map[string]bool
+}
+
+//NewRegistry fails on duplicate roles, unknown inherited roles and inheritance cycles
+func NewRegistry(roles ...Role) (*Registry, error) {
+	r := &Registry{
+		roles:       map[string]Role{},
+		permissions: map[string]map[string]bool{},
+	}
+	for _, role := range roles {
+		if _, exists := r.roles[role.Name]; exists {
+			return nil, errors.Errorf("Duplicate role '%s'", role.Name)
+		}
+		r.roles[role.Name] = role
+	}
+
+	for name := range r.roles {
+		permissions := map[string]bool{}
+		if err := r.collect(name, permissions, map[string]bool{}); err != nil {
+			return nil, err
+		}
+		r.permissions[name] = permissions
+	}
+	return r, nil
+}
+
+func (r *Registry) collect(name string, permissions map[string]bool, visiting map[string]bool) error {
+	role, ok := r.roles[name]
+	if !ok {
+		return errors.Errorf("Unknown role '%s'", name)
+	}
+	if visiting[name] {
+		return errors.Errorf("Role inheritance cycle at '%s'", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	for _, p := range role.Permissions {
+		permissions[p] = true
+	}
+	for _, inherited := range role.Inherits {
+		if err := r.collect(inherited, permissions, visiting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) Exists(roleName string) bool {
+	_, ok := r.roles[roleName]
+	return ok
+}
+
+//Roles returns all roles sorted by name
+func (r *Registry) Roles() []Role {
+	roles := []Role{}
+	for _, role := range r.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles
+}
+
+//Permissions returns the effective permissions of the roles, unknown roles are ignored
+func (r *Registry) Permissions(roleNames ...string) map[string]bool {
+	permissions := map[string]bool{}
+	for _, name := range roleNames {
+		for p := range r.permissions[name] {
+			permissions[p] = true
+		}
+	}
+	return permissions
+}
+
+func hasAll(granted map[string]bool, required ...string) bool {
+	if granted[AllPermissions] {
+		return true
+	}
+	for _, p := range required {
+		if !granted[p] {
+			return false
+		}
+	}
+	return true
+}
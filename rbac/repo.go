@@ -0,0 +1,13 @@
+package rbac
+
+//Repo stores the role names assigned to users
+type Repo interface {
+	Roles(userID string) ([]string, error)
+	//AssignRole must not add duplicates
+	AssignRole(userID, roleName string) error
+	RevokeRole(userID, roleName string) error
+}
+
+type RepoFactory interface {
+	Repo() Repo
+}
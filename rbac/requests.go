@@ -0,0 +1,10 @@
+package rbac
+
+type RequestFactory interface {
+	AssignRole() AssignRoleRequest
+}
+
+type AssignRoleRequest interface {
+	Validate() error
+	RoleName() string
+}
@@ -0,0 +1,9 @@
+package rbac
+
+type ResponseFactory interface {
+	Role(role Role) RoleResponse
+	UserRoles(userID string, roleNames []string) UserRolesResponse
+}
+
+type RoleResponse interface{}
+type UserRolesResponse interface{}
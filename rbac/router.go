@@ -0,0 +1,130 @@
+package rbac
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
+)
+
+//PermissionManageRoles is required to use the AdminRouter (admins have it implicitly)
+const PermissionManageRoles = "roles.manage"
+
+//AdminRouter lists roles and assigns or revokes roles of users. Non-admin managers can only assign or revoke roles
+//whose permissions they have themselves, so that they cannot escalate their own privileges.
+func AdminRouter(
+	authMiddleware auth.Middleware, rbacMiddleware Middleware,
+	rendering rendering.Service,
+	service Service,
+	requestFactory RequestFactory, responseFactory ResponseFactory) *chi.Mux {
+
+	r := chi.NewRouter()
+
+	r.Use(authMiddleware.Authenticate()...)
+	r.Use(authMiddleware.LoadUser())
+	r.Use(rbacMiddleware.RequirePermission(PermissionManageRoles))
+
+	canGrant := func(w http.ResponseWriter, r *http.Request, roleName string) bool {
+		granted := []string{}
+		for p := range service.Registry().Permissions(roleName) {
+			granted = append(granted, p)
+		}
+
+		allowed, err := service.HasPermissions(authMiddleware.GetContextUser(r.Context()), granted...)
+		if err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return false
+		}
+		if !allowed {
+			tmpErr := clienterror.NewError(errors.Errorf("Not allowed to manage role '%s' without having all its permissions", roleName), http.StatusForbidden)
+			rendering.RenderError(w, r, tmpErr, nil, http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+
+	r.Get("/roles", func(w http.ResponseWriter, r *http.Request) {
+		responses := []RoleResponse{}
+		for _, role := range service.Registry().Roles() {
+			responses = append(responses, responseFactory.Role(role))
+		}
+		render.Respond(w, r, responses)
+	})
+
+	r.Route("/users/{userID}/roles", func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := request.RequiredURLParam(w, r, "userID", rendering)
+			if !ok {
+				return
+			}
+
+			roleNames, err := service.UserRoles(userID)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.UserRoles(userID, roleNames))
+		})
+
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := request.RequiredURLParam(w, r, "userID", rendering)
+			if !ok {
+				return
+			}
+			body := requestFactory.AssignRole()
+			if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+				return
+			}
+			if !canGrant(w, r, body.RoleName()) {
+				return
+			}
+
+			if err := service.AssignRole(userID, body.RoleName()); err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+
+			roleNames, err := service.UserRoles(userID)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.UserRoles(userID, roleNames))
+		})
+
+		r.Delete("/{role}", func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := request.RequiredURLParam(w, r, "userID", rendering)
+			if !ok {
+				return
+			}
+			roleName, ok := request.RequiredURLParam(w, r, "role", rendering)
+			if !ok {
+				return
+			}
+			if !canGrant(w, r, roleName) {
+				return
+			}
+
+			if err := service.RevokeRole(userID, roleName); err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+
+			roleNames, err := service.UserRoles(userID)
+			if err != nil {
+				rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+				return
+			}
+			render.Respond(w, r, responseFactory.UserRoles(userID, roleNames))
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,75 @@
+package rbac
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/user"
+)
+
+type Service interface {
+	Registry() *Registry
+	UserRoles(userID string) ([]string, error)
+	//HasPermissions is always true for user.IsAdmin() users
+	HasPermissions(user user.User, permissions ...string) (bool, error)
+	AssignRole(userID, roleName string) error
+	RevokeRole(userID, roleName string) error
+}
+
+func DefaultService(registry *Registry, repoFactory RepoFactory) *defaultService {
+	return &defaultService{
+		registry,
+		repoFactory,
+	}
+}
+
+type defaultService struct {
+	registry    *Registry
+	repoFactory RepoFactory
+}
+
+func (s *defaultService) Registry() *Registry { return s.registry }
+
+func (s *defaultService) UserRoles(userID string) ([]string, error) {
+	roles, err := s.repoFactory.Repo().Roles(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get user roles")
+	}
+	return roles, nil
+}
+
+func (s *defaultService) HasPermissions(u user.User, permissions ...string) (bool, error) {
+	if u.IsAdmin() {
+		return true, nil
+	}
+
+	roles, err := s.UserRoles(u.ID())
+	if err != nil {
+		return false, err
+	}
+	return hasAll(s.registry.Permissions(roles...), permissions...), nil
+}
+
+func (s *defaultService) AssignRole(userID, roleName string) error {
+	if !s.registry.Exists(roleName) {
+		return clienterror.NewError(errors.Errorf("Unknown role '%s'", roleName), http.StatusBadRequest)
+	}
+	if err := s.repoFactory.Repo().AssignRole(userID, roleName); err != nil {
+		return errors.Wrapf(err, "Failed to assign role")
+	}
+
+	logrus.WithField("user-id", userID).WithField("role", roleName).Info("Assigned role")
+	return nil
+}
+
+func (s *defaultService) RevokeRole(userID, roleName string) error {
+	if err := s.repoFactory.Repo().RevokeRole(userID, roleName); err != nil {
+		return errors.Wrapf(err, "Failed to revoke role")
+	}
+
+	logrus.WithField("user-id", userID).WithField("role", roleName).Info("Revoked role")
+	return nil
+}
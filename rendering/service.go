@@ -32,7 +32,11 @@ func (*chiService) RenderError(w http.ResponseWriter, r *http.Request, err error
 		w.WriteHeader(defaultStatus)
 	}
 
-	render.JSON(w, r, map[string]interface{}{
+	response := map[string]interface{}{
 		"Error": userMsg,
-	})
+	}
+	if detailedErr, ok := err.(clienterror.DetailedError); ok && detailedErr.Details() != nil {
+		response["Details"] = detailedErr.Details()
+	}
+	render.JSON(w, r, response)
 }
@@ -0,0 +1,40 @@
+package request
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+//ClientInfo describes who made a request, for throttling, sessions and auditing. Use chi's middleware.RealIP and
+//middleware.RequestID in front of the routers to get the real client IP behind proxies and a request ID.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+type clientInfoCtxKey struct{}
+
+//ClientContext returns the request context with the ClientInfo of r added
+func ClientContext(r *http.Request) context.Context {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	info := ClientInfo{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+	return context.WithValue(r.Context(), clientInfoCtxKey{}, info)
+}
+
+//ClientInfoFromContext returns an empty ClientInfo if ctx was not created with ClientContext
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoCtxKey{}).(ClientInfo)
+	return info
+}
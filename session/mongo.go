@@ -0,0 +1,84 @@
+package session
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/francoishill/gomponents/mongo"
+)
+
+//MongoRepo is also its own RepoFactory, expired sessions (revoked or not) are removed by a TTL index
+func MongoRepo(m mongo.Mongo) *mongoRepo {
+	r := &mongoRepo{m}
+	indexes := []mgo.Index{
+		{Key: []string{"expires_at"}, ExpireAfter: time.Second},
+		{Key: []string{"user_id"}},
+	}
+	if err := m.EnsureIndexes(r.collection(), indexes); err != nil {
+		logrus.Panicf("Failed to ensure session indexes, error: %s", err.Error())
+	}
+	return r
+}
+
+type mongoRepo struct {
+	m mongo.Mongo
+}
+
+func (r *mongoRepo) Repo() Repo { return r }
+
+func (r *mongoRepo) collection() *mgo.Collection { return r.m.Collection("sessions") }
+
+func (r *mongoRepo) IsErrNotFound(err error) bool { return r.m.IsErrNotFound(err) }
+
+func (r *mongoRepo) Add(session Session) error {
+	return r.m.RefreshIfConnectionError(r.collection().Insert(session))
+}
+
+func (r *mongoRepo) Get(id string) (Session, error) {
+	var session Session
+	if err := r.collection().FindId(id).One(&session); err != nil {
+		return Session{}, r.m.RefreshIfConnectionError(err)
+	}
+	return session, nil
+}
+
+func (r *mongoRepo) ListForUser(userID string) ([]Session, error) {
+	query := bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+		//sessions without an expiry were started before it was added
+		"$or": []bson.M{
+			{"expires_at": bson.M{"$gt": time.Now()}},
+			{"expires_at": bson.M{"$exists": false}},
+		},
+	}
+	sessions := []Session{}
+	if err := r.collection().Find(query).Sort("-last_seen_at").All(&sessions); err != nil {
+		return nil, r.m.RefreshIfConnectionError(err)
+	}
+	return sessions, nil
+}
+
+func (r *mongoRepo) SetLastSeen(id string, lastSeenAt time.Time, ip string) error {
+	err := r.collection().UpdateId(id, bson.M{"$set": bson.M{"last_seen_at": lastSeenAt, "ip": ip}})
+	return r.m.RefreshIfConnectionError(err)
+}
+
+func (r *mongoRepo) SetExpiresAt(id string, expiresAt time.Time) error {
+	err := r.collection().UpdateId(id, bson.M{"$set": bson.M{"expires_at": expiresAt}})
+	return r.m.RefreshIfConnectionError(err)
+}
+
+func (r *mongoRepo) Revoke(id string, revokedAt time.Time) error {
+	err := r.collection().UpdateId(id, bson.M{"$set": bson.M{"revoked_at": revokedAt}})
+	return r.m.RefreshIfConnectionError(err)
+}
+
+func (r *mongoRepo) RevokeAllForUser(userID string, revokedAt time.Time) error {
+	query := bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}}
+	_, err := r.collection().UpdateAll(query, bson.M{"$set": bson.M{"revoked_at": revokedAt}})
+	return r.m.RefreshIfConnectionError(err)
+}
@@ -0,0 +1,20 @@
+package session
+
+import "time"
+
+type Repo interface {
+	IsErrNotFound(err error) bool
+
+	Add(session Session) error
+	Get(id string) (Session, error)
+	//ListForUser must only return sessions that are not revoked or expired (see Session.IsActive)
+	ListForUser(userID string) ([]Session, error)
+	SetLastSeen(id string, lastSeenAt time.Time, ip string) error
+	SetExpiresAt(id string, expiresAt time.Time) error
+	Revoke(id string, revokedAt time.Time) error
+	RevokeAllForUser(userID string, revokedAt time.Time) error
+}
+
+type RepoFactory interface {
+	Repo() Repo
+}
@@ -0,0 +1,12 @@
+package session
+
+type ResponseFactory interface {
+	//Session gets isCurrent=true for the session of the request
+	Session(session Session, isCurrent bool) SessionResponse
+	Revoked(sessionID string) RevokedResponse
+	AllRevoked(userID string) AllRevokedResponse
+}
+
+type SessionResponse interface{}
+type RevokedResponse interface{}
+type AllRevokedResponse interface{}
@@ -0,0 +1,68 @@
+package session
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
+)
+
+//Router lets the authenticated user list their sessions and sign out other devices. The authMiddleware must be
+//created with WithSessions for revoked sessions to stop working right away.
+func Router(
+	authMiddleware auth.Middleware,
+	rendering rendering.Service,
+	service Service,
+	responseFactory ResponseFactory) *chi.Mux {
+
+	r := chi.NewRouter()
+
+	r.Use(authMiddleware.Authenticate()...)
+	r.Use(authMiddleware.LoadUser())
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		user := authMiddleware.GetContextUser(r.Context())
+		sessions, err := service.List(user.ID())
+		if err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		currentSessionID := authMiddleware.GetContextSessionID(r.Context())
+		responses := []SessionResponse{}
+		for _, s := range sessions {
+			responses = append(responses, responseFactory.Session(s, s.ID == currentSessionID))
+		}
+		render.Respond(w, r, responses)
+	})
+
+	//revokes all sessions, including the current one
+	r.With(authMiddleware.RejectImpersonation()).Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		user := authMiddleware.GetContextUser(r.Context())
+		if err := service.RevokeAll(user.ID()); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+		render.Respond(w, r, responseFactory.AllRevoked(user.ID()))
+	})
+
+	r.With(authMiddleware.RejectImpersonation()).Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sessionID, ok := request.RequiredURLParam(w, r, "id", rendering)
+		if !ok {
+			return
+		}
+
+		user := authMiddleware.GetContextUser(r.Context())
+		if err := service.Revoke(user.ID(), sessionID); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+		render.Respond(w, r, responseFactory.Revoked(sessionID))
+	})
+
+	return r
+}
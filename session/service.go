@@ -0,0 +1,173 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/encryption"
+	"github.com/francoishill/gomponents/request"
+	"github.com/francoishill/gomponents/token"
+)
+
+//Service implements auth.Sessions and lets users manage their own sessions
+type Service interface {
+	Start(ctx context.Context, userID string) (sessionID string, err error)
+	Check(ctx context.Context, sessionID, userID string) error
+	End(sessionID string) error
+
+	List(userID string) ([]Session, error)
+	//Revoke returns a not found client error if the session does not belong to the user
+	Revoke(userID, sessionID string) error
+	RevokeAll(userID string) error
+}
+
+const (
+	//DefaultLastSeenInterval limits how often Check writes the last seen time of a session
+	DefaultLastSeenInterval = time.Minute
+	//DefaultTTL is the default expiry of refresh tokens, see WithTTL
+	DefaultTTL = token.DefaultRefreshExpiryDuration
+
+	idByteLength = 16
+)
+
+func DefaultService(repoFactory RepoFactory, encryption encryption.Service) *defaultService {
+	return &defaultService{
+		repoFactory:      repoFactory,
+		encryption:       encryption,
+		lastSeenInterval: DefaultLastSeenInterval,
+		ttl:              DefaultTTL,
+	}
+}
+
+type defaultService struct {
+	repoFactory      RepoFactory
+	encryption       encryption.Service
+	lastSeenInterval time.Duration
+	ttl              time.Duration
+}
+
+//WithTTL sets how long a session lasts after it started or was extended, it should be the expiry of the refresh
+//tokens (the expiryDuration of WithRefreshTokens in the token package)
+func (s *defaultService) WithTTL(ttl time.Duration) *defaultService {
+	s.ttl = ttl
+	return s
+}
+
+//WithLastSeenInterval overrides DefaultLastSeenInterval
+func (s *defaultService) WithLastSeenInterval(interval time.Duration) *defaultService {
+	s.lastSeenInterval = interval
+	return s
+}
+
+func (s *defaultService) Start(ctx context.Context, userID string) (string, error) {
+	id, err := s.encryption.NewSecureToken(idByteLength)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to generate session id")
+	}
+
+	client := request.ClientInfoFromContext(ctx)
+	now := time.Now()
+	session := Session{
+		ID:         id,
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.ttl),
+	}
+	if err := s.repoFactory.Repo().Add(session); err != nil {
+		return "", errors.Wrapf(err, "Failed to add session")
+	}
+
+	logrus.WithField("user-id", userID).WithField("session-id", id).Debug("Started session")
+	return id, nil
+}
+
+func (s *defaultService) Check(ctx context.Context, sessionID, userID string) error {
+	invalidErr := clienterror.NewError(errors.New("Session is revoked or does not exist"), http.StatusUnauthorized)
+
+	repo := s.repoFactory.Repo()
+	session, err := repo.Get(sessionID)
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return invalidErr
+		}
+		return errors.Wrapf(err, "Failed to get session")
+	}
+	if !session.IsActive() || session.UserID != userID {
+		return invalidErr
+	}
+
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) >= s.lastSeenInterval {
+		ip := request.ClientInfoFromContext(ctx).IP
+		if ip == "" {
+			ip = session.IP
+		}
+		if err := repo.SetLastSeen(session.ID, now, ip); err != nil {
+			//not worth failing the request for
+			logrus.WithField("session-id", session.ID).WithError(err).Error("Failed to update session last seen time")
+		}
+	}
+	return nil
+}
+
+func (s *defaultService) Extend(sessionID string) error {
+	if err := s.repoFactory.Repo().SetExpiresAt(sessionID, time.Now().Add(s.ttl)); err != nil {
+		return errors.Wrapf(err, "Failed to extend session")
+	}
+	return nil
+}
+
+func (s *defaultService) End(sessionID string) error {
+	if err := s.repoFactory.Repo().Revoke(sessionID, time.Now()); err != nil {
+		return errors.Wrapf(err, "Failed to revoke session")
+	}
+	logrus.WithField("session-id", sessionID).Debug("Ended session")
+	return nil
+}
+
+func (s *defaultService) List(userID string) ([]Session, error) {
+	sessions, err := s.repoFactory.Repo().ListForUser(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list sessions")
+	}
+	active := []Session{}
+	for _, session := range sessions {
+		if session.IsActive() {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+func (s *defaultService) Revoke(userID, sessionID string) error {
+	repo := s.repoFactory.Repo()
+	session, err := repo.Get(sessionID)
+	if err != nil && !repo.IsErrNotFound(err) {
+		return errors.Wrapf(err, "Failed to get session")
+	}
+	if err != nil || session.UserID != userID {
+		return clienterror.NewError(errors.Errorf("Session '%s' not found", sessionID), http.StatusNotFound)
+	}
+
+	if err := s.End(session.ID); err != nil {
+		return err
+	}
+	logrus.WithField("user-id", userID).WithField("session-id", sessionID).Info("Revoked session")
+	return nil
+}
+
+func (s *defaultService) RevokeAll(userID string) error {
+	if err := s.repoFactory.Repo().RevokeAllForUser(userID, time.Now()); err != nil {
+		return errors.Wrapf(err, "Failed to revoke sessions")
+	}
+	logrus.WithField("user-id", userID).Info("Revoked all sessions")
+	return nil
+}
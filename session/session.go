@@ -0,0 +1,21 @@
+package session
+
+import "time"
+
+//Session is the server-side record of a login, tokens carry its ID in the auth.SessionIDClaim
+type Session struct {
+	ID         string     `bson:"_id" json:"id"`
+	UserID     string     `bson:"user_id" json:"user_id"`
+	UserAgent  string     `bson:"user_agent" json:"user_agent"`
+	IP         string     `bson:"ip" json:"ip"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	LastSeenAt time.Time  `bson:"last_seen_at" json:"last_seen_at"`
+	RevokedAt  *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	//ExpiresAt follows the expiry of the refresh token and is extended on every refresh, it is zero for sessions
+	//started before it was added
+	ExpiresAt time.Time `bson:"expires_at,omitempty" json:"expires_at"`
+}
+
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && (s.ExpiresAt.IsZero() || time.Now().Before(s.ExpiresAt))
+}
@@ -0,0 +1,185 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+//JWK is a public key in RFC 7517 format
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+
+	//RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	//EC (x and y) and OKP (only x)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+//JWKSet is the document served by JWKSHandler
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+//PublicJWK is the public key of a KeyPair as JWK
+func PublicJWK(keyID string, publicKey crypto.PublicKey) (JWK, error) {
+	alg, err := algOf(publicKey)
+	if err != nil {
+		return JWK{}, err
+	}
+
+	jwk := JWK{Use: "sig", Alg: alg, Kid: keyID}
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBigInt(key.N, 0)
+		jwk.E = encodeBigInt(big.NewInt(int64(key.E)), 0)
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty, jwk.Crv = "EC", key.Curve.Params().Name
+		jwk.X = encodeBigInt(key.X, size)
+		jwk.Y = encodeBigInt(key.Y, size)
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	}
+	return jwk, nil
+}
+
+//PublicKey converts the JWK back to the public key, for services that fetch the JWK set to verify tokens (see
+//VerifyingJWTAuth)
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := func(name, value string) ([]byte, error) {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(b) == 0 {
+			return nil, errors.Errorf("Invalid JWK member '%s'", name)
+		}
+		return b, nil
+	}
+
+	var publicKey crypto.PublicKey
+	switch {
+	case jwk.Kty == "RSA":
+		n, err := decode("n", jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e", jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("Invalid JWK member 'e'")
+		}
+		publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	case jwk.Kty == "EC" && jwk.Crv == elliptic.P256().Params().Name:
+		x, err := decode("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y", jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("Invalid JWK, the point is not on the curve")
+		}
+		publicKey = key
+	case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+		x, err := decode("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Invalid JWK member 'x'")
+		}
+		publicKey = ed25519.PublicKey(x)
+	default:
+		return nil, errors.Errorf("Unsupported JWK type '%s' (curve '%s')", jwk.Kty, jwk.Crv)
+	}
+
+	if _, err := algOf(publicKey); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
+
+//JWKSHandler serves the public keys as a JWK set, mount it at /.well-known/jwks.json. Keep publishing a key that was
+//rotated out until the last token signed with it expired.
+func JWKSHandler(keys ...JWK) http.Handler {
+	body, err := json.Marshal(JWKSet{Keys: append([]JWK{}, keys...)})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(body)
+	})
+}
+
+//thumbprint is the RFC 7638 JWK thumbprint, the JSON members are required to be in lexicographic order
+func thumbprint(publicKey crypto.PublicKey) (string, error) {
+	jwk, err := PublicJWK("", publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to compute key thumbprint")
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+//encodeBigInt is base64url without padding, left padded with zeros to size bytes
+func encodeBigInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,146 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/pkg/errors"
+)
+
+//The signing algorithms, HS256 uses a shared secret (see JWTService) and the others a KeyPair (see
+//AsymmetricJWTService)
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+
+	minRSAKeyBits = 2048
+)
+
+//KeyPair is a private key with its JWS algorithm, ID is the "kid" header of the tokens and the JWK
+type KeyPair struct {
+	ID         string
+	Alg        string
+	PrivateKey crypto.Signer
+}
+
+func (k KeyPair) PublicKey() crypto.PublicKey { return k.PrivateKey.Public() }
+
+//NewKeyPair derives the algorithm from the key: RS256 for RSA (at least 2048 bits), ES256 for ECDSA P-256 and EdDSA
+//for Ed25519. An empty keyID uses the RFC 7638 thumbprint of the public key.
+func NewKeyPair(keyID string, privateKey crypto.Signer) (KeyPair, error) {
+	alg, err := algOf(privateKey.Public())
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	if keyID == "" {
+		if keyID, err = thumbprint(privateKey.Public()); err != nil {
+			return KeyPair{}, err
+		}
+	}
+	return KeyPair{ID: keyID, Alg: alg, PrivateKey: privateKey}, nil
+}
+
+//ParsePEMKeyPair parses a PKCS #8 ("PRIVATE KEY"), PKCS #1 ("RSA PRIVATE KEY") or SEC 1 ("EC PRIVATE KEY") private
+//key, see NewKeyPair for keyID
+func ParsePEMKeyPair(keyID string, pemData []byte) (KeyPair, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return KeyPair{}, errors.New("No PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return KeyPair{}, errors.Errorf("Unsupported PEM block type '%s'", block.Type)
+	}
+	if err != nil {
+		return KeyPair{}, errors.Wrapf(err, "Failed to parse %s", block.Type)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return KeyPair{}, errors.Errorf("Unsupported private key type %T", key)
+	}
+	return NewKeyPair(keyID, signer)
+}
+
+//LoadPEMKeyPair reads the private key file, see ParsePEMKeyPair
+func LoadPEMKeyPair(keyID string, path string) (KeyPair, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return KeyPair{}, errors.Wrapf(err, "Failed to read key file")
+	}
+	return ParsePEMKeyPair(keyID, pemData)
+}
+
+//ParsePEMPublicKey parses a PKIX ("PUBLIC KEY") or PKCS #1 ("RSA PUBLIC KEY") public key, like one exported from the
+//private key of a KeyPair
+func ParsePEMPublicKey(pemData []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("No PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, errors.Errorf("Unsupported PEM block type '%s'", block.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s", block.Type)
+	}
+	if _, err := algOf(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+//VerifyingJWTAuth verifies tokens of an AsymmetricJWTService with only its public key, like in a downstream service
+//that uses jwtauth.Verifier. The key can come from ParsePEMPublicKey or JWK.PublicKey.
+func VerifyingJWTAuth(publicKey crypto.PublicKey) (*jwtauth.JWTAuth, error) {
+	alg, err := algOf(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return jwtauth.New(alg, nil, publicKey), nil
+}
+
+func algOf(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return "", errors.Errorf("RSA keys must have at least %d bits", minRSAKeyBits)
+		}
+		return AlgRS256, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return "", errors.Errorf("ECDSA keys must use curve P-256 for ES256, not %s", key.Curve.Params().Name)
+		}
+		return AlgES256, nil
+	case ed25519.PublicKey:
+		return AlgEdDSA, nil
+	}
+	return "", errors.Errorf("Unsupported key type %T", publicKey)
+}
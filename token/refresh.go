@@ -0,0 +1,198 @@
+package token
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/encryption"
+	"github.com/francoishill/gomponents/user"
+)
+
+//Pair is an access token with its refresh token, RefreshToken is empty when refresh tokens are not enabled
+type Pair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+//RefreshToken is the stored form of a refresh token. Every refresh rotates the token to a new one in the same family,
+//presenting an already used token revokes the whole family since it means the token was stolen.
+type RefreshToken struct {
+	ID        string     `bson:"_id" json:"id"`
+	FamilyID  string     `bson:"family_id" json:"family_id"`
+	UserID    string     `bson:"user_id" json:"user_id"`
+	Hash      string     `bson:"hash" json:"-"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty" json:"used_at,omitempty"`
+	RevokedAt *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	//Claims are the extra access token claims, see CreatePairWithClaims
+	Claims map[string]interface{} `bson:"claims,omitempty" json:"claims,omitempty"`
+}
+
+type RefreshRepo interface {
+	IsErrNotFound(err error) bool
+
+	Add(token RefreshToken) error
+	Get(id string) (RefreshToken, error)
+	//MarkUsed must atomically set UsedAt only if it is not set yet, it returns false if the token was already used
+	MarkUsed(id string, usedAt time.Time) (bool, error)
+	RevokeFamily(familyID string, revokedAt time.Time) error
+	RevokeAllForUser(userID string, revokedAt time.Time) error
+}
+
+type RefreshRepoFactory interface {
+	Repo() RefreshRepo
+}
+
+const (
+	DefaultRefreshExpiryDuration = 30 * 24 * time.Hour
+
+	refreshIDByteLength     = 12
+	refreshSecretByteLength = 32
+	refreshTokenSeparator   = "."
+)
+
+//WithRefreshTokens makes CreatePair also return a refresh token, a zero expiryDuration uses DefaultRefreshExpiryDuration
+func (t *jwtService) WithRefreshTokens(repoFactory RefreshRepoFactory, encryption encryption.Service, expiryDuration time.Duration) *jwtService {
+	t.refreshRepoFactory = repoFactory
+	t.encryption = encryption
+	t.refreshExpiryDuration = expiryDuration
+	if t.refreshExpiryDuration <= 0 {
+		t.refreshExpiryDuration = DefaultRefreshExpiryDuration
+	}
+	return t
+}
+
+func (t *jwtService) refreshEnabled() bool { return t.refreshRepoFactory != nil }
+
+func (t *jwtService) CreatePair(user user.User) (Pair, error) {
+	return t.CreatePairWithClaims(user, nil)
+}
+
+func (t *jwtService) CreatePairWithClaims(user user.User, extraClaims map[string]interface{}) (Pair, error) {
+	if !t.refreshEnabled() {
+		accessToken, err := t.create(user, "", extraClaims, 0)
+		if err != nil {
+			return Pair{}, err
+		}
+		return Pair{AccessToken: accessToken}, nil
+	}
+
+	familyID, err := t.encryption.NewSecureToken(refreshIDByteLength)
+	if err != nil {
+		return Pair{}, errors.Wrapf(err, "Failed to generate refresh token family")
+	}
+	accessToken, err := t.create(user, familyID, extraClaims, 0)
+	if err != nil {
+		return Pair{}, err
+	}
+	refreshToken, err := t.addRefreshToken(user.ID(), familyID, extraClaims)
+	if err != nil {
+		return Pair{}, err
+	}
+
+	return Pair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (t *jwtService) Refresh(refreshToken string, loadUser func(userID string, extraClaims map[string]interface{}) (user.User, error)) (Pair, error) {
+	if !t.refreshEnabled() {
+		return Pair{}, clienterror.NewError(errors.New("Refresh tokens are not enabled"), http.StatusBadRequest)
+	}
+	invalidErr := clienterror.NewError(errors.New("Invalid or expired refresh token"), http.StatusUnauthorized)
+
+	parts := strings.SplitN(refreshToken, refreshTokenSeparator, 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Pair{}, invalidErr
+	}
+
+	repo := t.refreshRepoFactory.Repo()
+	stored, err := repo.Get(parts[0])
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return Pair{}, invalidErr
+		}
+		return Pair{}, errors.Wrapf(err, "Failed to get refresh token")
+	}
+	if !t.encryption.VerifyTokenHash(parts[1], stored.Hash) {
+		return Pair{}, invalidErr
+	}
+
+	logger := logrus.WithField("user-id", stored.UserID).WithField("token-family", stored.FamilyID)
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return Pair{}, invalidErr
+	}
+
+	now := time.Now()
+	marked := false
+	if stored.UsedAt == nil {
+		if marked, err = repo.MarkUsed(stored.ID, now); err != nil {
+			return Pair{}, errors.Wrapf(err, "Failed to mark refresh token as used")
+		}
+	}
+	if !marked {
+		logger.Warn("Refresh token reuse detected, revoking the token family")
+		if err := t.revokeFamily(stored.FamilyID); err != nil {
+			logger.WithError(err).Error("Failed to revoke refresh token family")
+		}
+		return Pair{}, invalidErr
+	}
+
+	u, err := loadUser(stored.UserID, stored.Claims)
+	if err != nil {
+		return Pair{}, err
+	}
+
+	accessToken, err := t.create(u, stored.FamilyID, stored.Claims, 0)
+	if err != nil {
+		return Pair{}, err
+	}
+	newRefreshToken, err := t.addRefreshToken(stored.UserID, stored.FamilyID, stored.Claims)
+	if err != nil {
+		return Pair{}, err
+	}
+
+	logger.Debug("Rotated refresh token")
+	return Pair{AccessToken: accessToken, RefreshToken: newRefreshToken}, nil
+}
+
+func (t *jwtService) RevokeRefreshTokens(userID string) error {
+	if !t.refreshEnabled() {
+		return nil
+	}
+	if err := t.refreshRepoFactory.Repo().RevokeAllForUser(userID, time.Now()); err != nil {
+		return errors.Wrapf(err, "Failed to revoke refresh tokens")
+	}
+	return nil
+}
+
+func (t *jwtService) addRefreshToken(userID, familyID string, extraClaims map[string]interface{}) (string, error) {
+	id, err := t.encryption.NewSecureToken(refreshIDByteLength)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to generate refresh token id")
+	}
+	secret, err := t.encryption.NewSecureToken(refreshSecretByteLength)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to generate refresh token secret")
+	}
+
+	now := time.Now()
+	stored := RefreshToken{
+		ID:        id,
+		FamilyID:  familyID,
+		UserID:    userID,
+		Hash:      t.encryption.HashToken(secret),
+		CreatedAt: now,
+		ExpiresAt: now.Add(t.refreshExpiryDuration),
+		Claims:    extraClaims,
+	}
+	if err := t.refreshRepoFactory.Repo().Add(stored); err != nil {
+		return "", errors.Wrapf(err, "Failed to store refresh token")
+	}
+
+	return id + refreshTokenSeparator + secret, nil
+}
@@ -0,0 +1,271 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/francoishill/gomponents/mongo"
+)
+
+//RevocationStore keeps track of revoked access tokens until they would have expired anyway
+type RevocationStore interface {
+	Revoke(jti string, expiresAt time.Time) error
+	//RevokeFamily revokes the access tokens issued with the refresh token family (the "fam" claim)
+	RevokeFamily(familyID string, expiresAt time.Time) error
+	//RevokeAllForUser revokes all tokens of the user that were issued at or before revokedAt (millisecond precision)
+	RevokeAllForUser(userID string, revokedAt time.Time) error
+	//IsRevoked checks the token, its family (empty if it has none) and the user
+	IsRevoked(jti, familyID, userID string, issuedAt time.Time) (bool, error)
+}
+
+var ErrRevoked = errors.New("Token is revoked")
+
+//WithRevocationStore makes the middlewares reject revoked tokens
+func (t *jwtService) WithRevocationStore(store RevocationStore) *jwtService {
+	t.revocationStore = store
+	return t
+}
+
+func (t *jwtService) verifyAccessToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		token, claims, err := jwtauth.FromContext(ctx)
+		if err != nil || token == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, isSigned := claims[purposeClaim]; isSigned {
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(ctx, token, jwtauth.ErrUnauthorized)))
+			return
+		}
+
+		if t.revocationStore != nil {
+			jti, _ := claims[idClaim].(string)
+			familyID, _ := claims[familyClaim].(string)
+			userID, _ := claims["user_id"].(string)
+			revoked, err := t.revocationStore.IsRevoked(jti, familyID, userID, issuedAt(claims))
+			if err != nil {
+				logrus.WithError(err).Error("Unable to check token revocation")
+				revoked = true
+			}
+			if revoked {
+				next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(ctx, token, ErrRevoked)))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *jwtService) Revoke(ctx context.Context) error {
+	_, claims, err := jwtauth.FromContext(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get token from request context")
+	}
+
+	if familyID, _ := claims[familyClaim].(string); familyID != "" && t.refreshEnabled() {
+		if err := t.revokeFamily(familyID); err != nil {
+			return err
+		}
+	}
+
+	//without a revocation store the access token stays valid until it expires
+	if t.revocationStore == nil {
+		return nil
+	}
+	jti, _ := claims[idClaim].(string)
+	if jti == "" {
+		return errors.New("Invalid token, jti is missing")
+	}
+	if err := t.revocationStore.Revoke(jti, time.Unix(claimInt64(claims, "exp"), 0)); err != nil {
+		return errors.Wrapf(err, "Failed to revoke token")
+	}
+	return nil
+}
+
+func (t *jwtService) RevokeAllForUser(userID string) error {
+	if err := t.RevokeRefreshTokens(userID); err != nil {
+		return err
+	}
+
+	if t.revocationStore == nil {
+		return nil
+	}
+	//every token issued up to and including this millisecond is revoked, waiting for the next millisecond makes sure
+	//that a token issued right after (like when logging in again after a password change) is not
+	revokedAt := time.Now().Truncate(time.Millisecond)
+	if err := t.revocationStore.RevokeAllForUser(userID, revokedAt); err != nil {
+		return errors.Wrapf(err, "Failed to revoke tokens of user")
+	}
+	time.Sleep(time.Until(revokedAt.Add(time.Millisecond)))
+	return nil
+}
+
+//issuedAt prefers the millisecond claim, tokens created before it was added fall back to the second of "iat"
+func issuedAt(claims jwtauth.Claims) time.Time {
+	if ms := claimInt64(claims, issuedAtMsClaim); ms > 0 {
+		return time.Unix(0, ms*int64(time.Millisecond))
+	}
+	return time.Unix(claimInt64(claims, "iat"), 0)
+}
+
+//revokeFamily revokes the refresh tokens of the family and the access tokens that were issued with them
+func (t *jwtService) revokeFamily(familyID string) error {
+	now := time.Now()
+	if err := t.refreshRepoFactory.Repo().RevokeFamily(familyID, now); err != nil {
+		return errors.Wrapf(err, "Failed to revoke refresh token family")
+	}
+	if t.revocationStore == nil {
+		return nil
+	}
+	//access tokens of a family are created with the default expiry, see Refresh
+	if err := t.revocationStore.RevokeFamily(familyID, now.Add(t.expiryDuration)); err != nil {
+		return errors.Wrapf(err, "Failed to revoke access tokens of refresh token family")
+	}
+	return nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrapf(err, "Unable to generate token id")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func claimInt64(claims jwtauth.Claims, key string) int64 {
+	switch v := claims[key].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
+
+//familyRevocationID keeps revoked families with the revoked tokens, the prefix cannot clash with a (hex) jti
+func familyRevocationID(familyID string) string { return "family:" + familyID }
+
+//MemoryRevocationStore is only suitable for a single instance, revocations are lost on restart
+func MemoryRevocationStore() *memoryRevocationStore {
+	return &memoryRevocationStore{
+		tokens: map[string]time.Time{},
+		users:  map[string]time.Time{},
+	}
+}
+
+type memoryRevocationStore struct {
+	lock   sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+}
+
+func (s *memoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for id, exp := range s.tokens {
+		if exp.Before(now) {
+			delete(s.tokens, id)
+		}
+	}
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *memoryRevocationStore) RevokeFamily(familyID string, expiresAt time.Time) error {
+	return s.Revoke(familyRevocationID(familyID), expiresAt)
+}
+
+func (s *memoryRevocationStore) RevokeAllForUser(userID string, revokedAt time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.users[userID] = revokedAt
+	return nil
+}
+
+func (s *memoryRevocationStore) IsRevoked(jti, familyID, userID string, issuedAt time.Time) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if _, ok := s.tokens[jti]; ok {
+		return true, nil
+	}
+	if _, ok := s.tokens[familyRevocationID(familyID)]; ok && familyID != "" {
+		return true, nil
+	}
+	if revokedAt, ok := s.users[userID]; ok && !issuedAt.After(revokedAt) {
+		return true, nil
+	}
+	return false, nil
+}
+
+//MongoRevocationStore shares revocations between instances, revoked tokens are removed by a TTL index once expired
+func MongoRevocationStore(m mongo.Mongo) *mongoRevocationStore {
+	s := &mongoRevocationStore{m}
+	indexes := []mgo.Index{{Key: []string{"expires_at"}, ExpireAfter: time.Second}}
+	if err := m.EnsureIndexes(s.tokens(), indexes); err != nil {
+		logrus.Panicf("Failed to ensure revoked token indexes, error: %s", err.Error())
+	}
+	return s
+}
+
+type mongoRevocationStore struct {
+	m mongo.Mongo
+}
+
+func (s *mongoRevocationStore) tokens() *mgo.Collection { return s.m.Collection("revoked_tokens") }
+func (s *mongoRevocationStore) users() *mgo.Collection  { return s.m.Collection("revoked_user_tokens") }
+
+func (s *mongoRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	_, err := s.tokens().UpsertId(jti, bson.M{"$set": bson.M{"expires_at": expiresAt}})
+	return s.m.RefreshIfConnectionError(err)
+}
+
+func (s *mongoRevocationStore) RevokeFamily(familyID string, expiresAt time.Time) error {
+	return s.Revoke(familyRevocationID(familyID), expiresAt)
+}
+
+func (s *mongoRevocationStore) RevokeAllForUser(userID string, revokedAt time.Time) error {
+	_, err := s.users().UpsertId(userID, bson.M{"$set": bson.M{"issued_before": revokedAt}})
+	return s.m.RefreshIfConnectionError(err)
+}
+
+func (s *mongoRevocationStore) IsRevoked(jti, familyID, userID string, issuedAt time.Time) (bool, error) {
+	ids := []string{jti}
+	if familyID != "" {
+		ids = append(ids, familyRevocationID(familyID))
+	}
+	count, err := s.tokens().Find(bson.M{"_id": bson.M{"$in": ids}}).Count()
+	if err != nil {
+		return false, s.m.RefreshIfConnectionError(err)
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	var revokedUser struct {
+		//the field name is kept from when the cutoff was exclusive, so that earlier revocations still apply
+		RevokedAt time.Time `bson:"issued_before"`
+	}
+	if err := s.users().FindId(userID).One(&revokedUser); err != nil {
+		if s.m.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, s.m.RefreshIfConnectionError(err)
+	}
+	return !issuedAt.After(revokedUser.RevokedAt), nil
+}
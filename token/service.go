@@ -5,10 +5,12 @@ import (
 	"net/http"
 	"time"
 
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/jwtauth"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/francoishill/gomponents/encryption"
 	"github.com/francoishill/gomponents/user"
 )
 
@@ -16,48 +18,192 @@ type Service interface {
 	Middlewares() []func(http.Handler) http.Handler
 
 	Create(user user.User) (string, error)
+	//CreateWithClaims creates an access token (without refresh token) with extraClaims, a zero ttl uses the expiry
+	//duration of the service
+	CreateWithClaims(user user.User, extraClaims map[string]interface{}, ttl time.Duration) (string, error)
 	UserIDFromContext(ctx context.Context) (string, error)
+
+	//CreateSigned creates a token that can only be parsed back with ParseSigned for the same purpose, it is not
+	//accepted as an access token
+	CreateSigned(purpose string, userID string, ttl time.Duration) (string, error)
+	ParseSigned(purpose string, tokenString string) (userID string, err error)
+	//CreateSignedWithClaims adds extraClaims (that do not clash with the standard claims) to the signed token, they are
+	//returned by ParseSignedWithClaims
+	CreateSignedWithClaims(purpose string, userID string, extraClaims map[string]interface{}, ttl time.Duration) (string, error)
+	ParseSignedWithClaims(purpose string, tokenString string) (userID string, claims map[string]interface{}, err error)
+
+	CreatePair(user user.User) (Pair, error)
+	//CreatePairWithClaims adds extraClaims (like the active organization) to the access token, they are kept when the
+	//pair is refreshed
+	CreatePairWithClaims(user user.User, extraClaims map[string]interface{}) (Pair, error)
+	ClaimFromContext(ctx context.Context, key string) (interface{}, bool)
+	//Refresh rotates the refresh token, loadUser provides the (current) user for the new access token and can reject
+	//the refresh based on the extra claims of the pair
+	Refresh(refreshToken string, loadUser func(userID string, extraClaims map[string]interface{}) (user.User, error)) (Pair, error)
+	RevokeRefreshTokens(userID string) error
+
+	//Revoke revokes the refresh token family of the access token in ctx, and the access token itself (with the other
+	//access tokens of the family) if a revocation store is set (see WithRevocationStore)
+	Revoke(ctx context.Context) error
+	//RevokeAllForUser revokes all access and refresh tokens issued to the user so far
+	RevokeAllForUser(userID string) error
 }
 
 func JWTService(signKey []byte, expiryDuration time.Duration, addUserInfoToClaimsFunc func(claims jwtauth.Claims, user user.User) error) *jwtService {
 	if len(signKey) == 0 {
 		logrus.Panic("signKey is required in InitTokenAuth")
 	}
-	auth := jwtauth.New("HS256", signKey, nil)
+	auth := jwtauth.New(AlgHS256, signKey, nil)
+
+	return &jwtService{
+		alg:                     AlgHS256,
+		auth:                    auth,
+		signKey:                 signKey,
+		expiryDuration:          expiryDuration,
+		addUserInfoToClaimsFunc: addUserInfoToClaimsFunc,
+	}
+}
+
+//AsymmetricJWTService signs with the private key of keyPair (RS256, ES256 or EdDSA), other services can verify the
+//tokens with only the public key (see PublicJWK, JWKSHandler and VerifyingJWTAuth)
+func AsymmetricJWTService(keyPair KeyPair, expiryDuration time.Duration, addUserInfoToClaimsFunc func(claims jwtauth.Claims, user user.User) error) *jwtService {
+	if keyPair.PrivateKey == nil {
+		logrus.Panic("keyPair.PrivateKey is required in AsymmetricJWTService")
+	}
+	alg, err := algOf(keyPair.PublicKey())
+	if err != nil {
+		logrus.WithError(err).Panic("Unsupported key in AsymmetricJWTService")
+	}
+	if keyPair.Alg != "" && keyPair.Alg != alg {
+		logrus.Panicf("Key pair alg '%s' does not match its key, expected '%s'", keyPair.Alg, alg)
+	}
+	auth := jwtauth.New(alg, keyPair.PrivateKey, keyPair.PublicKey())
 
 	return &jwtService{
-		auth,
-		expiryDuration,
-		addUserInfoToClaimsFunc,
+		alg:                     alg,
+		auth:                    auth,
+		signKey:                 keyPair.PrivateKey,
+		keyPair:                 &keyPair,
+		expiryDuration:          expiryDuration,
+		addUserInfoToClaimsFunc: addUserInfoToClaimsFunc,
 	}
 }
 
+const (
+	purposeClaim = "purpose"
+	idClaim      = "jti"
+	familyClaim  = "fam"
+	//issuedAtMsClaim is the issue time in milliseconds, "iat" has second precision which is too coarse to revoke all
+	//tokens of a user (see RevokeAllForUser)
+	issuedAtMsClaim = "iat_ms"
+)
+
 type jwtService struct {
+	alg                     string
 	auth                    *jwtauth.JWTAuth
+	signKey                 interface{}
+	keyPair                 *KeyPair //nil for HS256
 	expiryDuration          time.Duration
 	addUserInfoToClaimsFunc func(claims jwtauth.Claims, user user.User) error
+
+	refreshRepoFactory    RefreshRepoFactory
+	encryption            encryption.Service
+	refreshExpiryDuration time.Duration
+
+	revocationStore RevocationStore
 }
 
 func (t *jwtService) Middlewares() []func(http.Handler) http.Handler {
 	return []func(http.Handler) http.Handler{
 		jwtauth.Verifier(t.auth), // Seek, verify and validate JWT tokens (only sets invalid token error on context but continues, the Authenticator errors on invalid token)
+		t.verifyAccessToken,      // Sets an error on context for purpose tokens and revoked tokens
 		jwtauth.Authenticator,    // Handle valid / invalid tokens
 	}
 }
 
 func (t *jwtService) Create(user user.User) (string, error) {
+	return t.create(user, "", nil, 0)
+}
+
+func (t *jwtService) CreateWithClaims(user user.User, extraClaims map[string]interface{}, ttl time.Duration) (string, error) {
+	return t.create(user, "", extraClaims, ttl)
+}
+
+//create adds extraClaims that do not clash with the standard claims or the user info claims, a zero ttl uses
+//expiryDuration
+func (t *jwtService) create(user user.User, familyID string, extraClaims map[string]interface{}, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = t.expiryDuration
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	//refer to github.com/dgrijalva/jwt-go->StandardClaims and https://tools.ietf.org/html/rfc7519#section-4.1
+	now := time.Now()
 	claims := jwtauth.Claims{
-		"iat": time.Now().Unix(),                       //IssuedAt
-		"exp": time.Now().Add(t.expiryDuration).Unix(), //ExpiresAt
+		"iat":           now.Unix(),                               //IssuedAt
+		"exp":           now.Add(ttl).Unix(),                      //ExpiresAt
+		idClaim:         jti,                                      //JWT ID, used for revocation
+		issuedAtMsClaim: now.UnixNano() / int64(time.Millisecond), //IssuedAt in milliseconds, used for revocation
+	}
+	if familyID != "" {
+		claims[familyClaim] = familyID
 	}
 
 	if err := t.addUserInfoToClaimsFunc(claims, user); err != nil {
 		return "", errors.Wrapf(err, "Failed to add user info to token claims")
 	}
 
-	_, tokenString, err := t.auth.Encode(claims)
-	return tokenString, err
+	for key, value := range extraClaims {
+		if _, exists := claims[key]; !exists && key != purposeClaim {
+			claims[key] = value
+		}
+	}
+
+	return t.encode(claims)
+}
+
+//encode signs like jwtauth.Encode, but also sets the "kid" header for key pairs
+func (t *jwtService) encode(claims jwtauth.Claims) (string, error) {
+	jwtToken := jwt.NewWithClaims(jwt.GetSigningMethod(t.alg), jwt.MapClaims(claims))
+	if t.keyPair != nil && t.keyPair.ID != "" {
+		jwtToken.Header["kid"] = t.keyPair.ID
+	}
+	return jwtToken.SignedString(t.signKey)
+}
+
+//PublicJWK is the public key of the service, it is false for HS256 since its secret cannot be published
+func (t *jwtService) PublicJWK() (JWK, bool) {
+	if t.keyPair == nil {
+		return JWK{}, false
+	}
+	jwk, err := PublicJWK(t.keyPair.ID, t.keyPair.PublicKey())
+	if err != nil {
+		logrus.WithError(err).Error("Unable to convert public key to JWK")
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+//JWKSHandler serves PublicJWK (if any) with the previous keys that are still in use, see the JWKSHandler func
+func (t *jwtService) JWKSHandler(previous ...JWK) http.Handler {
+	keys := []JWK{}
+	if jwk, ok := t.PublicJWK(); ok {
+		keys = append(keys, jwk)
+	}
+	return JWKSHandler(append(keys, previous...)...)
+}
+
+func (t *jwtService) ClaimFromContext(ctx context.Context, key string) (interface{}, bool) {
+	_, claims, err := jwtauth.FromContext(ctx)
+	if err != nil {
+		return nil, false
+	}
+	value, ok := claims[key]
+	return value, ok
 }
 
 func (t *jwtService) UserIDFromContext(ctx context.Context) (string, error) {
@@ -66,6 +212,10 @@ func (t *jwtService) UserIDFromContext(ctx context.Context) (string, error) {
 		return "", errors.Wrapf(err, "Failed to get token from request context")
 	}
 
+	if _, isSigned := claims[purposeClaim]; isSigned {
+		return "", errors.New("Invalid token, a purpose token cannot be used as access token")
+	}
+
 	tmpUserID, ok := claims["user_id"]
 	if !ok {
 		userMessage := "Invalid token, user_id is missing"
@@ -80,3 +230,57 @@ func (t *jwtService) UserIDFromContext(ctx context.Context) (string, error) {
 
 	return userID, nil
 }
+
+func (t *jwtService) CreateSigned(purpose string, userID string, ttl time.Duration) (string, error) {
+	return t.CreateSignedWithClaims(purpose, userID, nil, ttl)
+}
+
+func (t *jwtService) CreateSignedWithClaims(purpose string, userID string, extraClaims map[string]interface{}, ttl time.Duration) (string, error) {
+	claims := jwtauth.Claims{
+		"iat":        time.Now().Unix(),
+		"exp":        time.Now().Add(ttl).Unix(),
+		"sub":        userID,
+		purposeClaim: purpose,
+	}
+	for key, value := range extraClaims {
+		if _, exists := claims[key]; !exists {
+			claims[key] = value
+		}
+	}
+
+	tokenString, err := t.encode(claims)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to encode %s token", purpose)
+	}
+	return tokenString, nil
+}
+
+func (t *jwtService) ParseSigned(purpose string, tokenString string) (string, error) {
+	userID, _, err := t.ParseSignedWithClaims(purpose, tokenString)
+	return userID, err
+}
+
+func (t *jwtService) ParseSignedWithClaims(purpose string, tokenString string) (string, map[string]interface{}, error) {
+	parsed, err := t.auth.Decode(tokenString)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "Invalid %s token", purpose)
+	}
+	if parsed == nil || !parsed.Valid || parsed.Method.Alg() != t.alg || jwtauth.IsExpired(parsed) {
+		return "", nil, errors.Errorf("Invalid %s token", purpose)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", nil, errors.Errorf("Invalid %s token, unexpected claims type", purpose)
+	}
+	if tokenPurpose, _ := claims[purposeClaim].(string); tokenPurpose != purpose {
+		return "", nil, errors.Errorf("Invalid %s token, purpose mismatch", purpose)
+	}
+
+	userID, isStr := claims["sub"].(string)
+	if !isStr || userID == "" {
+		return "", nil, errors.Errorf("Invalid %s token, subject is missing", purpose)
+	}
+
+	return userID, claims, nil
+}
@@ -0,0 +1,28 @@
+package totp
+
+import "time"
+
+//Enrollment holds the TOTP secret of a user, the secret is only stored encrypted
+type Enrollment struct {
+	UserID          string    `bson:"_id" json:"user_id"`
+	EncryptedSecret string    `bson:"encrypted_secret" json:"-"`
+	Confirmed       bool      `bson:"confirmed" json:"confirmed"`
+	LastUsedStep    int64     `bson:"last_used_step" json:"-"`
+	CreatedAt       time.Time `bson:"created_at" json:"created_at"`
+}
+
+type Repo interface {
+	IsErrNotFound(err error) bool
+
+	Get(userID string) (Enrollment, error)
+	//Save adds or replaces the enrollment of enrollment.UserID
+	Save(enrollment Enrollment) error
+	//SetLastUsedStep must atomically set LastUsedStep only if it is lower than step, it returns false if it was not
+	//(the code of the step was already used)
+	SetLastUsedStep(userID string, step int64) (bool, error)
+	Delete(userID string) error
+}
+
+type RepoFactory interface {
+	Repo() Repo
+}
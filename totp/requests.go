@@ -0,0 +1,11 @@
+package totp
+
+type RequestFactory interface {
+	Confirm() CodeRequest
+	Disable() CodeRequest
+}
+
+type CodeRequest interface {
+	Validate() error
+	Code() string
+}
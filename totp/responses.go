@@ -0,0 +1,11 @@
+package totp
+
+type ResponseFactory interface {
+	Enrollment(uri, secret string) EnrollmentResponse
+	Enabled() EnabledResponse
+	Disabled() DisabledResponse
+}
+
+type EnrollmentResponse interface{}
+type EnabledResponse interface{}
+type DisabledResponse interface{}
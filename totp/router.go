@@ -0,0 +1,71 @@
+package totp
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/rendering"
+	"github.com/francoishill/gomponents/request"
+)
+
+func Router(
+	authMiddleware auth.Middleware,
+	rendering rendering.Service,
+	service Service,
+	requestFactory RequestFactory, responseFactory ResponseFactory) *chi.Mux {
+
+	r := chi.NewRouter()
+
+	r.Use(authMiddleware.Authenticate()...)
+	r.Use(authMiddleware.LoadUser())
+	r.Use(authMiddleware.RejectImpersonation())
+
+	r.Post("/enroll", func(w http.ResponseWriter, r *http.Request) {
+		user := authMiddleware.GetContextUser(r.Context())
+
+		uri, secret, err := service.BeginEnrollment(user)
+		if err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.Enrollment(uri, secret))
+	})
+
+	r.Post("/confirm", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.Confirm()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		user := authMiddleware.GetContextUser(r.Context())
+		if err := service.ConfirmEnrollment(request.ClientContext(r), user.ID(), body.Code()); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.Enabled())
+	})
+
+	r.Post("/disable", func(w http.ResponseWriter, r *http.Request) {
+		body := requestFactory.Disable()
+		if err := request.DecodeAndValidateJSON(r.Body, body); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusBadRequest)
+			return
+		}
+
+		user := authMiddleware.GetContextUser(r.Context())
+		if err := service.Disable(request.ClientContext(r), user.ID(), body.Code()); err != nil {
+			rendering.RenderError(w, r, err, nil, http.StatusInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, responseFactory.Disabled())
+	})
+
+	return r
+}
@@ -0,0 +1,228 @@
+package totp
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/francoishill/gomponents/auth"
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/encryption"
+	"github.com/francoishill/gomponents/lockout"
+	"github.com/francoishill/gomponents/request"
+	"github.com/francoishill/gomponents/user"
+)
+
+//Service manages TOTP enrollment and implements auth.MFA for the second login step
+type Service interface {
+	auth.MFA
+
+	BeginEnrollment(user user.User) (uri, secret string, err error)
+	//ConfirmEnrollment and Disable count failed codes towards the lockout, see WithLockout
+	ConfirmEnrollment(ctx context.Context, userID, code string) error
+	Disable(ctx context.Context, userID, code string) error
+}
+
+//DefaultService panics for an invalid config, like a Period shorter than a second
+func DefaultService(config Config, repoFactory RepoFactory, cipher encryption.Cipher, accountNameFunc func(user user.User) string) *defaultService {
+	if err := config.check(); err != nil {
+		logrus.Panicf("Invalid TOTP config, error: %s", err.Error())
+	}
+	return &defaultService{
+		config:          config,
+		repoFactory:     repoFactory,
+		cipher:          cipher,
+		accountNameFunc: accountNameFunc,
+	}
+}
+
+type defaultService struct {
+	config          Config
+	repoFactory     RepoFactory
+	cipher          encryption.Cipher
+	accountNameFunc func(user user.User) string
+	lockout         lockout.Service
+}
+
+//WithLockout throttles failed confirm and disable codes per user and per client IP, use the same lockout.Service as
+//the auth service so login MFA codes count too
+func (s *defaultService) WithLockout(lockout lockout.Service) *defaultService {
+	s.lockout = lockout
+	return s
+}
+
+func (s *defaultService) IsEnabled(userID string) (bool, error) {
+	repo := s.repoFactory.Repo()
+	enrollment, err := repo.Get(userID)
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "Failed to get TOTP enrollment")
+	}
+	return enrollment.Confirmed, nil
+}
+
+func (s *defaultService) Verify(userID, code string) error {
+	enrollment, err := s.getEnrollment(userID)
+	if err != nil {
+		return err
+	}
+	if !enrollment.Confirmed {
+		return clienterror.NewError(errors.New("TOTP is not enabled"), http.StatusBadRequest)
+	}
+
+	step, err := s.verifyCode(enrollment, code)
+	if err != nil {
+		return err
+	}
+	//verifyCode already rejected used steps, this catches the same code used concurrently
+	updated, err := s.repoFactory.Repo().SetLastUsedStep(userID, step)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to save last used TOTP step")
+	}
+	if !updated {
+		return invalidCodeErr()
+	}
+	return nil
+}
+
+func (s *defaultService) BeginEnrollment(u user.User) (string, string, error) {
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", u.ID())
+
+	enabled, err := s.IsEnabled(u.ID())
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", clienterror.NewError(errors.New("TOTP is already enabled, disable it first"), http.StatusConflict)
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	encryptedSecret, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "Unable to encrypt TOTP secret")
+	}
+
+	enrollment := Enrollment{
+		UserID:          u.ID(),
+		EncryptedSecret: encryptedSecret,
+		CreatedAt:       time.Now(),
+	}
+	if err := s.repoFactory.Repo().Save(enrollment); err != nil {
+		return "", "", errors.Wrapf(err, "Failed to save TOTP enrollment")
+	}
+
+	logger.Debug("Started TOTP enrollment")
+	return s.config.URI(s.accountNameFunc(u), secret), secret, nil
+}
+
+func (s *defaultService) ConfirmEnrollment(ctx context.Context, userID, code string) error {
+	return s.withLockout(ctx, userID, func() error { return s.confirmEnrollment(userID, code) })
+}
+
+func (s *defaultService) confirmEnrollment(userID, code string) error {
+	enrollment, err := s.getEnrollment(userID)
+	if err != nil {
+		return err
+	}
+	if enrollment.Confirmed {
+		return clienterror.NewError(errors.New("TOTP is already enabled"), http.StatusConflict)
+	}
+	step, err := s.verifyCode(enrollment, code)
+	if err != nil {
+		return err
+	}
+
+	enrollment.Confirmed = true
+	enrollment.LastUsedStep = step
+	if err := s.repoFactory.Repo().Save(enrollment); err != nil {
+		return errors.Wrapf(err, "Failed to confirm TOTP enrollment")
+	}
+
+	logrus.WithField("user-id", userID).Debug("Enabled TOTP")
+	return nil
+}
+
+func (s *defaultService) Disable(ctx context.Context, userID, code string) error {
+	if err := s.withLockout(ctx, userID, func() error { return s.Verify(userID, code) }); err != nil {
+		return err
+	}
+	if err := s.repoFactory.Repo().Delete(userID); err != nil {
+		return errors.Wrapf(err, "Failed to delete TOTP enrollment")
+	}
+
+	logrus.WithField("user-id", userID).Debug("Disabled TOTP")
+	return nil
+}
+
+func (s *defaultService) getEnrollment(userID string) (Enrollment, error) {
+	repo := s.repoFactory.Repo()
+	enrollment, err := repo.Get(userID)
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return Enrollment{}, clienterror.NewError(errors.New("TOTP is not enrolled"), http.StatusBadRequest)
+		}
+		return Enrollment{}, errors.Wrapf(err, "Failed to get TOTP enrollment")
+	}
+	return enrollment, nil
+}
+
+func (s *defaultService) verifyCode(enrollment Enrollment, code string) (int64, error) {
+	secret, err := s.cipher.Decrypt(enrollment.EncryptedSecret)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to decrypt TOTP secret")
+	}
+
+	step, ok, err := s.config.Validate(secret, code, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	//a code may only be used once, also within its validity window
+	if !ok || step <= enrollment.LastUsedStep {
+		return 0, invalidCodeErr()
+	}
+	return step, nil
+}
+
+//withLockout runs verify unless the user or client IP is blocked, invalid codes count as failed attempts
+func (s *defaultService) withLockout(ctx context.Context, userID string, verify func() error) error {
+	if s.lockout == nil {
+		return verify()
+	}
+	logger := logrus.NewEntry(logrus.StandardLogger()).WithField("user-id", userID)
+	ip := request.ClientInfoFromContext(ctx).IP
+
+	if err := s.lockout.Check(userID, ip); err != nil {
+		logger.WithError(err).Warn("TOTP attempt blocked by lockout")
+		return err
+	}
+	err := verify()
+	switch {
+	case err == nil:
+		if err := s.lockout.RecordSuccess(userID, ip); err != nil {
+			logger.WithError(err).Error("Unable to reset failed TOTP attempts")
+		}
+	case isInvalidCodeErr(err):
+		if err := s.lockout.RecordFailure(userID, ip); err != nil {
+			logger.WithError(err).Error("Unable to record failed TOTP attempt")
+		}
+	}
+	return err
+}
+
+func invalidCodeErr() error {
+	return clienterror.NewError(errors.New("Invalid TOTP code"), http.StatusUnauthorized)
+}
+
+//isInvalidCodeErr relies on invalidCodeErr being the only 401 of the service
+func isInvalidCodeErr(err error) bool {
+	clientErr, isClientErr := err.(clienterror.Error)
+	return isClientErr && clientErr.Status() == http.StatusUnauthorized
+}
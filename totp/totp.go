@@ -0,0 +1,128 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Config holds the RFC 6238 parameters, the defaults (SHA1, 6 digits, 30 seconds) are what authenticator apps support
+type Config struct {
+	Issuer string
+	Digits int
+	Period time.Duration
+	//Skew is the number of periods before and after the current one that are still accepted
+	Skew int
+}
+
+func DefaultConfig(issuer string) Config {
+	return Config{
+		Issuer: issuer,
+		Digits: 6,
+		Period: 30 * time.Second,
+		Skew:   1,
+	}
+}
+
+//check rejects configs that Step and Code cannot work with, authenticator apps only support whole seconds and 6 to 8
+//digits
+func (c Config) check() error {
+	if c.Period < time.Second || c.Period%time.Second != 0 {
+		return errors.Errorf("TOTP period must be a whole number of seconds, got %s", c.Period)
+	}
+	if c.Digits < 6 || c.Digits > 8 {
+		return errors.Errorf("TOTP digits must be between 6 and 8, got %d", c.Digits)
+	}
+	if c.Skew < 0 {
+		return errors.Errorf("TOTP skew may not be negative, got %d", c.Skew)
+	}
+	return nil
+}
+
+const secretByteLength = 20
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretByteLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrapf(err, "Unable to generate TOTP secret")
+	}
+	return secretEncoding.EncodeToString(b), nil
+}
+
+//URI builds the otpauth:// URI that authenticator apps read (usually from a QR code)
+func (c Config) URI(accountName, secret string) string {
+	label := url.PathEscape(accountName)
+	if c.Issuer != "" {
+		label = url.PathEscape(c.Issuer) + ":" + label
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", c.Digits))
+	params.Set("period", fmt.Sprintf("%d", int(c.Period/time.Second)))
+	if c.Issuer != "" {
+		params.Set("issuer", c.Issuer)
+	}
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+//Step returns the time step (counter) of t
+func (c Config) Step(t time.Time) int64 {
+	return t.Unix() / int64(c.Period/time.Second)
+}
+
+func (c Config) Code(secret string, step int64) (string, error) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid TOTP secret")
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	//dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < c.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", c.Digits, value%mod), nil
+}
+
+//Validate returns the matched time step so that callers can reject a code that was already used
+func (c Config) Validate(secret, code string, t time.Time) (step int64, ok bool, err error) {
+	code = strings.TrimSpace(code)
+	if len(code) != c.Digits {
+		return 0, false, nil
+	}
+
+	current := c.Step(t)
+	for i := -c.Skew; i <= c.Skew; i++ {
+		expected, err := c.Code(secret, current+int64(i))
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + int64(i), true, nil
+		}
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,163 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/clienterror"
+)
+
+const (
+	DefaultQueryLimit = 50
+	MaxQueryLimit     = 500
+)
+
+//Query selects a page of users for Repo.ListPage. The field names in Filters and Sort are defined by the repo, see
+//CheckFields. Cursor and Offset cannot be combined, a page continues after Page.NextCursor or at Offset.
+type Query struct {
+	//Filters match users whose field equals the value
+	Filters map[string]string
+	//Search is free text, the repo decides which fields it searches (like name and email)
+	Search string
+	Sort   []Sort
+
+	Cursor string
+	Offset int
+	Limit  int
+}
+
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+//Page is one page of the users matching a query, Total is the count of all matching users. NextCursor is empty on
+//the last page.
+type Page struct {
+	Users      []User
+	Total      int
+	Offset     int
+	Limit      int
+	NextCursor string
+}
+
+//ParseQuery reads the query from URL values: filter[<field>], q (search), sort (comma separated fields, prefixed with
+//"-" for descending, like "-created_at,email"), cursor, offset and limit
+func ParseQuery(values url.Values) (Query, error) {
+	q := Query{
+		Filters: map[string]string{},
+		Search:  strings.TrimSpace(values.Get("q")),
+		Cursor:  values.Get("cursor"),
+		Limit:   DefaultQueryLimit,
+	}
+
+	for key, value := range values {
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		field := key[len("filter[") : len(key)-1]
+		if field == "" {
+			return Query{}, errors.New("Query param 'filter[]' is missing the field")
+		}
+		q.Filters[field] = value[0]
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			field = strings.TrimSpace(field)
+			s := Sort{Field: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+			if s.Field == "" {
+				return Query{}, errors.Errorf("Query param 'sort' has an empty field")
+			}
+			q.Sort = append(q.Sort, s)
+		}
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *int
+	}{{"offset", &q.Offset}, {"limit", &q.Limit}} {
+		if value := values.Get(param.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return Query{}, errors.Errorf("Query param '%s' must be a non-negative number", param.name)
+			}
+			*param.dest = n
+		}
+	}
+	if q.Cursor != "" && q.Offset > 0 {
+		return Query{}, errors.New("Query params 'cursor' and 'offset' cannot be combined")
+	}
+
+	return q.Normalized(), nil
+}
+
+//Normalized applies the default and maximum limit
+func (q Query) Normalized() Query {
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	if q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	return q
+}
+
+//CheckFields is meant for repos to reject filters and sorts on fields they do not support, the error has a 400 status
+func (q Query) CheckFields(filterFields, sortFields []string) error {
+	contains := func(fields []string, field string) bool {
+		for _, f := range fields {
+			if f == field {
+				return true
+			}
+		}
+		return false
+	}
+
+	for field := range q.Filters {
+		if !contains(filterFields, field) {
+			return clienterror.NewError(errors.Errorf("Cannot filter users on '%s'", field), http.StatusBadRequest)
+		}
+	}
+	for _, s := range q.Sort {
+		if !contains(sortFields, s.Field) {
+			return clienterror.NewError(errors.Errorf("Cannot sort users on '%s'", s.Field), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+//EncodeCursor is meant for repos to build Page.NextCursor from the sort values of the last user on the page (and its
+//ID to break ties), the cursor is opaque to clients
+func EncodeCursor(values map[string]interface{}) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to encode cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+//DecodeCursor reverses EncodeCursor, the error has a 400 status since the cursor comes from the client. Numbers are
+//decoded as float64.
+func DecodeCursor(cursor string) (map[string]interface{}, error) {
+	invalidErr := clienterror.NewError(errors.New("Invalid cursor"), http.StatusBadRequest)
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalidErr
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, invalidErr
+	}
+	return values, nil
+}
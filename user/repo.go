@@ -1,11 +1,27 @@
 package user
 
 type Repo interface {
+	IsErrNotFound(err error) bool
 	IsDupErr(err error) bool
 
 	Add(user User) error
 	Get(id string) (User, error)
+	//GetByEmail must match the email case-insensitively, like the duplicate check of Add and Update
+	GetByEmail(email string) (User, error)
 	List() ([]User, error)
+	//ListPage returns the users matching q.Filters and q.Search sorted by q.Sort, see Query for the paging
+	ListPage(q Query) (Page, error)
+
+	//Update saves all fields of the user (found by ID), it must return a duplicate error for a duplicate email
+	Update(user User) error
+	Delete(id string) error
+
+	SetPasswordHash(id string, passwordHash string) error
+	SetEmailVerified(id string) error
+	//SetEmailUnverified is used when the email changes, the new address has to be verified again
+	SetEmailUnverified(id string) error
+	//SetStatus saves the status as is, the caller checks the transition (see Status.CheckTransition)
+	SetStatus(id string, status Status) error
 }
 
 type RepoFactory interface {
@@ -0,0 +1,88 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/clienterror"
+)
+
+//Status is the lifecycle state of an account, only active accounts can authenticate. An empty status counts as
+//StatusActive so that users stored before statuses existed keep working.
+type Status string
+
+const (
+	//StatusPendingVerification accounts still have to verify their email or accept their invite
+	StatusPendingVerification Status = "pending_verification"
+	StatusActive              Status = "active"
+	//StatusSuspended accounts are blocked by an admin, like for abuse
+	StatusSuspended Status = "suspended"
+	//StatusLocked accounts are blocked for security reasons, like a suspected compromise
+	StatusLocked Status = "locked"
+	//StatusDeleted accounts are soft-deleted, it is a final status
+	StatusDeleted Status = "deleted"
+)
+
+//transitions lists the statuses that every status may change to, it is the only place that defines them
+var transitions = map[Status][]Status{
+	StatusPendingVerification: {StatusActive, StatusSuspended, StatusDeleted},
+	StatusActive:              {StatusSuspended, StatusLocked, StatusDeleted},
+	StatusSuspended:           {StatusActive, StatusDeleted},
+	StatusLocked:              {StatusActive, StatusSuspended, StatusDeleted},
+	StatusDeleted:             {},
+}
+
+func (s Status) normalized() Status {
+	if s == "" {
+		return StatusActive
+	}
+	return s
+}
+
+func (s Status) IsValid() bool {
+	_, ok := transitions[s.normalized()]
+	return ok
+}
+
+//CanTransitionTo is false for changes to the same status
+func (s Status) CanTransitionTo(to Status) bool {
+	for _, allowed := range transitions[s.normalized()] {
+		if allowed == to.normalized() {
+			return true
+		}
+	}
+	return false
+}
+
+//CheckTransition returns a client error (400 for an unknown status, 409 otherwise) if s cannot change to to
+func (s Status) CheckTransition(to Status) error {
+	if !to.IsValid() {
+		return clienterror.NewError(errors.Errorf("Unknown account status '%s'", to), http.StatusBadRequest)
+	}
+	if !s.CanTransitionTo(to) {
+		return clienterror.NewError(errors.Errorf("Account status cannot change from '%s' to '%s'", s.normalized(), to), http.StatusConflict)
+	}
+	return nil
+}
+
+//IsDisabled is true for suspended users, which is what the disable endpoints of the admin router set
+func IsDisabled(u User) bool {
+	return u.Status() == StatusSuspended
+}
+
+//CheckActive returns a client error for accounts that cannot authenticate: 403 for pending verification and
+//suspended accounts, 423 for locked accounts and 401 for deleted (and unknown) statuses, like for a missing user
+func (s Status) CheckActive() error {
+	switch s.normalized() {
+	case StatusActive:
+		return nil
+	case StatusPendingVerification:
+		return clienterror.NewError(errors.New("Account is pending verification"), http.StatusForbidden)
+	case StatusSuspended:
+		return clienterror.NewError(errors.New("Account is suspended"), http.StatusForbidden)
+	case StatusLocked:
+		return clienterror.NewError(errors.New("Account is locked"), http.StatusLocked)
+	}
+	return clienterror.NewError(errors.New("Account does not exist"), http.StatusUnauthorized)
+}
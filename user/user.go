@@ -4,4 +4,7 @@ type User interface {
 	ID() string
 
 	IsAdmin() bool
+	IsEmailVerified() bool
+	//Status must be StatusActive (or empty) to authenticate, see Status.CheckActive
+	Status() Status
 }
@@ -0,0 +1,16 @@
+package usertoken
+
+type Repo interface {
+	IsErrNotFound(err error) bool
+
+	Add(token Token) error
+	Get(id string) (Token, error)
+	//Remove deletes the token only if it still has the purpose and hash, in one operation so that it can only be used
+	//once. It must return a not found error if there is no such token (like when it was already used).
+	Remove(id string, purpose Purpose, hash string) error
+	DeleteAll(purpose Purpose, userID string) error
+}
+
+type RepoFactory interface {
+	Repo() Repo
+}
@@ -0,0 +1,103 @@
+package usertoken
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/francoishill/gomponents/clienterror"
+	"github.com/francoishill/gomponents/encryption"
+)
+
+//Service issues and consumes single-use, expiring tokens. The plain token handed out has the form
+//"<id>.<secret>", the id is used to look the token up and the secret is compared against its stored hash.
+type Service interface {
+	Issue(purpose Purpose, userID string, ttl time.Duration) (token string, err error)
+	Consume(purpose Purpose, token string) (Token, error)
+	RevokeAll(purpose Purpose, userID string) error
+}
+
+func DefaultService(repoFactory RepoFactory, encryption encryption.Service) *defaultService {
+	return &defaultService{
+		repoFactory,
+		encryption,
+	}
+}
+
+type defaultService struct {
+	repoFactory RepoFactory
+	encryption  encryption.Service
+}
+
+const (
+	idByteLength     = 12
+	secretByteLength = 32
+	separator        = "."
+)
+
+func (s *defaultService) Issue(purpose Purpose, userID string, ttl time.Duration) (string, error) {
+	id, err := s.encryption.NewSecureToken(idByteLength)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to generate token id")
+	}
+	secret, err := s.encryption.NewSecureToken(secretByteLength)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to generate token secret")
+	}
+
+	now := time.Now()
+	token := Token{
+		ID:        id,
+		Purpose:   purpose,
+		UserID:    userID,
+		Hash:      s.encryption.HashToken(secret),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.repoFactory.Repo().Add(token); err != nil {
+		return "", errors.Wrapf(err, "Failed to store %s token", purpose)
+	}
+
+	return id + separator + secret, nil
+}
+
+func (s *defaultService) Consume(purpose Purpose, plainToken string) (Token, error) {
+	invalidErr := clienterror.NewError(errors.Errorf("Invalid or expired %s token", purpose), http.StatusBadRequest)
+
+	parts := strings.SplitN(plainToken, separator, 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Token{}, invalidErr
+	}
+
+	//the token is only removed once the secret matches, a wrong guess must not use up the token of someone else
+	repo := s.repoFactory.Repo()
+	token, err := repo.Get(parts[0])
+	if err != nil {
+		if repo.IsErrNotFound(err) {
+			return Token{}, invalidErr
+		}
+		return Token{}, errors.Wrapf(err, "Failed to load %s token", purpose)
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Purpose), []byte(purpose)) != 1 || !s.encryption.VerifyTokenHash(parts[1], token.Hash) || token.IsExpired() {
+		return Token{}, invalidErr
+	}
+
+	if err := repo.Remove(token.ID, token.Purpose, token.Hash); err != nil {
+		if repo.IsErrNotFound(err) {
+			//used by a concurrent request
+			return Token{}, invalidErr
+		}
+		return Token{}, errors.Wrapf(err, "Failed to remove %s token", purpose)
+	}
+	return token, nil
+}
+
+func (s *defaultService) RevokeAll(purpose Purpose, userID string) error {
+	if err := s.repoFactory.Repo().DeleteAll(purpose, userID); err != nil {
+		return errors.Wrapf(err, "Failed to revoke %s tokens", purpose)
+	}
+	return nil
+}
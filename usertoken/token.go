@@ -0,0 +1,26 @@
+package usertoken
+
+import "time"
+
+//Purpose scopes a token to a single flow so that a token issued for one flow cannot be used in another
+type Purpose string
+
+const (
+	PurposePasswordReset Purpose = "password-reset"
+	PurposeMagicLogin    Purpose = "magic-login"
+	PurposeInvite        Purpose = "invite"
+	//PurposeMFAPending makes the MFA pending token of a login single-use, it is not sent to the user
+	PurposeMFAPending Purpose = "mfa-pending"
+)
+
+//Token is the stored form of a single-use token, only the hash of the secret part is kept
+type Token struct {
+	ID        string    `bson:"_id" json:"id"`
+	Purpose   Purpose   `bson:"purpose" json:"purpose"`
+	UserID    string    `bson:"user_id" json:"user_id"`
+	Hash      string    `bson:"hash" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+func (t *Token) IsExpired() bool { return time.Now().After(t.ExpiresAt) }